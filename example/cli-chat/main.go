@@ -13,17 +13,19 @@ import (
 	"github.com/lucasmenendez/gop2p/pkg/message"
 	"github.com/lucasmenendez/gop2p/pkg/node"
 	"github.com/lucasmenendez/gop2p/pkg/peer"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
 )
 
-func getOptions() int {
+func getOptions() (int, bool) {
 	minSafePort, maxSafePort := 49152, 65535
 	limit := new(big.Int).SetInt64(int64(maxSafePort - minSafePort))
 	r, _ := rand.Int(rand.Reader, limit)
 	randomSafePort := int(r.Int64()) + minSafePort
 	selfPortFlag := flag.Int("self", randomSafePort, "self node port")
+	tcpFlag := flag.Bool("tcp", false, "use TCP transport instead of HTTP")
 	flag.Parse()
 
-	return *selfPortFlag
+	return *selfPortFlag, *tcpFlag
 }
 
 func printInputs(client *node.Node) {
@@ -47,12 +49,16 @@ func printInputs(client *node.Node) {
 }
 
 func main() {
-	// Get parsed current node and entry point node ports from cmd flags
-	selfPort := getOptions()
+	// Get parsed current node port and transport from cmd flags
+	selfPort, useTCP := getOptions()
 
-	// Start current node on provided port
+	// Start current node on provided port with the selected transport
+	opts := []node.Option{}
+	if useTCP {
+		opts = append(opts, node.WithTransport(transport.NewTCP()))
+	}
 	selfPeer, _ := peer.Me(selfPort, true)
-	client := node.New(selfPeer)
+	client := node.New(selfPeer, opts...)
 	client.Start()
 
 	// Launch a goroutine to handle new messages and errors
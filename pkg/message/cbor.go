@@ -0,0 +1,579 @@
+package message
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+)
+
+// CBOR major types, defined by RFC 8949, used to encode the messages.
+const (
+	cborUint   byte = 0
+	cborNegInt byte = 1
+	cborBytes  byte = 2
+	cborText   byte = 3
+	cborArray  byte = 4
+	cborMap    byte = 5
+	cborTag    byte = 6
+	cborSimple byte = 7
+)
+
+// CBOR simple values supported by the codec.
+const (
+	cborFalse     byte = 0xf4
+	cborTrue      byte = 0xf5
+	cborNull      byte = 0xf6
+	cborUndefined byte = 0xf7
+)
+
+// maxCBORDepth contains the maximum number of nested arrays, maps and tags of
+// a CBOR message to decode it.
+const maxCBORDepth = 32
+
+// cborWriter struct appends the data items of a message encoded as CBOR to
+// its buffer, using always the shortest form of the integers and the lengths.
+type cborWriter struct {
+	buf []byte
+}
+
+// head function appends the initial byte of a data item with the provided
+// major type and its argument.
+func (w *cborWriter) head(major byte, arg uint64) {
+	major <<= 5
+	switch {
+	case arg < 24:
+		w.buf = append(w.buf, major|byte(arg))
+	case arg <= math.MaxUint8:
+		w.buf = append(w.buf, major|24, byte(arg))
+	case arg <= math.MaxUint16:
+		w.buf = binary.BigEndian.AppendUint16(append(w.buf, major|25), uint16(arg))
+	case arg <= math.MaxUint32:
+		w.buf = binary.BigEndian.AppendUint32(append(w.buf, major|26), uint32(arg))
+	default:
+		w.buf = binary.BigEndian.AppendUint64(append(w.buf, major|27), arg)
+	}
+}
+
+// uint function appends the provided unsigned integer.
+func (w *cborWriter) uint(v uint64) {
+	w.head(cborUint, v)
+}
+
+// int function appends the provided integer, as a negative integer if it is
+// lower than zero.
+func (w *cborWriter) int(v int64) {
+	if v < 0 {
+		w.head(cborNegInt, uint64(-(v + 1)))
+		return
+	}
+	w.head(cborUint, uint64(v))
+}
+
+// bytes function appends the provided bytes as a byte string, or null if they
+// are nil.
+func (w *cborWriter) bytes(v []byte) {
+	if v == nil {
+		w.null()
+		return
+	}
+	w.head(cborBytes, uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+// string function appends the provided string as a text string.
+func (w *cborWriter) string(v string) {
+	w.head(cborText, uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+// bool function appends the provided boolean.
+func (w *cborWriter) bool(v bool) {
+	if v {
+		w.buf = append(w.buf, cborTrue)
+	} else {
+		w.buf = append(w.buf, cborFalse)
+	}
+}
+
+// null function appends the null value.
+func (w *cborWriter) null() {
+	w.buf = append(w.buf, cborNull)
+}
+
+// cborObject struct collects the entries of a map to append them once they
+// are counted.
+type cborObject struct {
+	cborWriter
+	size uint64
+}
+
+// key function appends the provided key of a new entry and returns the writer
+// to append its value.
+func (o *cborObject) key(k string) *cborWriter {
+	o.size++
+	o.string(k)
+	return &o.cborWriter
+}
+
+// object function appends a map with the entries appended by the provided
+// function.
+func (w *cborWriter) object(entries func(o *cborObject)) {
+	o := &cborObject{}
+	entries(o)
+	w.head(cborMap, o.size)
+	w.buf = append(w.buf, o.buf...)
+}
+
+// message function appends the provided message as a map with the same keys
+// and omitted fields as its JSON encoding.
+func (w *cborWriter) message(msg *Message) {
+	w.object(func(o *cborObject) {
+		if msg.ID != "" {
+			o.key("id").string(msg.ID)
+		}
+		if msg.Timestamp != 0 {
+			o.key("timestamp").int(msg.Timestamp)
+		}
+		o.key("type").int(int64(msg.Type))
+		if msg.TTL != 0 {
+			o.key("ttl").int(int64(msg.TTL))
+		}
+		if msg.Topic != "" {
+			o.key("topic").string(msg.Topic)
+		}
+		if msg.ReplyTo != "" {
+			o.key("reply_to").string(msg.ReplyTo)
+		}
+		if msg.Chunk != nil {
+			o.key("chunk").chunk(msg.Chunk)
+		}
+		o.key("data").bytes(msg.Data)
+		if msg.Encrypted {
+			o.key("encrypted").bool(true)
+		}
+		if msg.Error != "" {
+			o.key("error").string(msg.Error)
+		}
+		o.key("from").peer(msg.From)
+		if len(msg.To) > 0 {
+			to := o.key("to")
+			to.head(cborArray, uint64(len(msg.To)))
+			for _, p := range msg.To {
+				to.peer(p)
+			}
+		}
+		if len(msg.Updates) > 0 {
+			updates := o.key("updates")
+			updates.head(cborArray, uint64(len(msg.Updates)))
+			for _, update := range msg.Updates {
+				updates.update(update)
+			}
+		}
+		if len(msg.Signature) > 0 {
+			o.key("signature").bytes(msg.Signature)
+		}
+	})
+}
+
+// chunk function appends the provided chunk position as a map.
+func (w *cborWriter) chunk(c *Chunk) {
+	w.object(func(o *cborObject) {
+		o.key("stream").string(c.Stream)
+		o.key("seq").uint(c.Seq)
+		if c.Name != "" {
+			o.key("name").string(c.Name)
+		}
+		if c.Size != 0 {
+			o.key("size").int(c.Size)
+		}
+		if c.Final {
+			o.key("final").bool(true)
+		}
+		if len(c.Hash) > 0 {
+			o.key("hash").bytes(c.Hash)
+		}
+	})
+}
+
+// peer function appends the provided peer as a map, or null if it is nil. The
+// metadata entries are sorted by key.
+func (w *cborWriter) peer(p *peer.Peer) {
+	if p == nil {
+		w.null()
+		return
+	}
+	w.object(func(o *cborObject) {
+		o.key("port").int(int64(p.Port))
+		o.key("address").string(p.Address)
+		if len(p.PublicKey) > 0 {
+			o.key("key").bytes(p.PublicKey)
+		}
+		if len(p.EncryptionKey) > 0 {
+			o.key("encryption_key").bytes(p.EncryptionKey)
+		}
+		if p.Relay != nil {
+			o.key("relay").peer(p.Relay)
+		}
+		if len(p.Metadata) > 0 {
+			keys := make([]string, 0, len(p.Metadata))
+			for key := range p.Metadata {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			metadata := o.key("metadata")
+			metadata.head(cborMap, uint64(len(keys)))
+			for _, key := range keys {
+				metadata.string(key)
+				metadata.string(p.Metadata[key])
+			}
+		}
+	})
+}
+
+// update function appends the provided membership update as a map, or null if
+// it is nil.
+func (w *cborWriter) update(u *peer.Update) {
+	if u == nil {
+		w.null()
+		return
+	}
+	w.object(func(o *cborObject) {
+		o.key("peer").peer(u.Peer)
+		o.key("state").int(int64(u.State))
+		o.key("incarnation").uint(u.Incarnation)
+	})
+}
+
+// cborReader struct reads the data items of a message encoded as CBOR from
+// its buffer. It supports the definite lengths items, the integers, the byte
+// and text strings, the arrays, the maps with text keys, the booleans and the
+// null and undefined values. The tags are ignored, decoding only the tagged
+// items.
+type cborReader struct {
+	buf   []byte
+	depth int
+}
+
+// argument function reads the argument of the data item with the provided
+// additional information.
+func (r *cborReader) argument(info byte) (uint64, error) {
+	size := 0
+	switch info {
+	case 24:
+		size = 1
+	case 25:
+		size = 2
+	case 26:
+		size = 4
+	case 27:
+		size = 8
+	default:
+		if info < 24 {
+			return uint64(info), nil
+		}
+		return 0, fmt.Errorf("unsupported CBOR indefinite length")
+	}
+	if len(r.buf) < size {
+		return 0, fmt.Errorf("malformed CBOR message")
+	}
+
+	var arg uint64
+	for _, b := range r.buf[:size] {
+		arg = arg<<8 | uint64(b)
+	}
+	r.buf = r.buf[size:]
+	return arg, nil
+}
+
+// value function reads the next data item and returns it as an uint64 or an
+// int64 for the integers, []byte, string, []interface{},
+// map[string]interface{}, bool or nil. It returns an error if the data item
+// is malformed or not supported.
+func (r *cborReader) value() (interface{}, error) {
+	if len(r.buf) == 0 {
+		return nil, fmt.Errorf("malformed CBOR message")
+	}
+	initial := r.buf[0]
+	r.buf = r.buf[1:]
+
+	major := initial >> 5
+	if major == cborSimple {
+		switch initial {
+		case cborFalse:
+			return false, nil
+		case cborTrue:
+			return true, nil
+		case cborNull, cborUndefined:
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unsupported CBOR simple value or float")
+	}
+	arg, err := r.argument(initial & 0x1f)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborUint:
+		return arg, nil
+	case cborNegInt:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("CBOR integer overflow")
+		}
+		return -int64(arg) - 1, nil
+	case cborBytes, cborText:
+		if arg > uint64(len(r.buf)) {
+			return nil, fmt.Errorf("malformed CBOR message")
+		}
+		v := make([]byte, arg)
+		copy(v, r.buf)
+		r.buf = r.buf[arg:]
+		if major == cborBytes {
+			return v, nil
+		} else if !utf8.Valid(v) {
+			return nil, fmt.Errorf("malformed CBOR text string")
+		}
+		return string(v), nil
+	}
+
+	if r.depth++; r.depth > maxCBORDepth {
+		return nil, fmt.Errorf("CBOR message too deep")
+	}
+	defer func() { r.depth-- }()
+	switch major {
+	case cborArray:
+		// Every item takes one byte at least
+		if arg > uint64(len(r.buf)) {
+			return nil, fmt.Errorf("malformed CBOR message")
+		}
+		items := make([]interface{}, arg)
+		for i := range items {
+			if items[i], err = r.value(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case cborMap:
+		// Every entry takes two bytes at least
+		if arg > uint64(len(r.buf))/2 {
+			return nil, fmt.Errorf("malformed CBOR message")
+		}
+		entries := make(map[string]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, err := r.value()
+			if err != nil {
+				return nil, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("unsupported CBOR map key")
+			}
+			if entries[k], err = r.value(); err != nil {
+				return nil, err
+			}
+		}
+		return entries, nil
+	default:
+		// The cborTag items are decoded as the item tagged
+		return r.value()
+	}
+}
+
+// cborDecoder struct converts the data items read by the cborReader into the
+// fields of a message. Once a data item has an unexpected type, the error is
+// kept and every next conversion returns its zero value. The missing and null
+// data items are converted into zero values.
+type cborDecoder struct {
+	err error
+}
+
+// fail function marks the message as malformed because a data item of the
+// provided kind is expected.
+func (d *cborDecoder) fail(kind string) {
+	if d.err == nil {
+		d.err = fmt.Errorf("malformed CBOR message: %s expected", kind)
+	}
+}
+
+// int function converts the provided data item into an integer.
+func (d *cborDecoder) int(v interface{}) int64 {
+	switch i := v.(type) {
+	case nil:
+		return 0
+	case int64:
+		return i
+	case uint64:
+		if i <= math.MaxInt64 {
+			return int64(i)
+		}
+	}
+	d.fail("integer")
+	return 0
+}
+
+// uint function converts the provided data item into an unsigned integer.
+func (d *cborDecoder) uint(v interface{}) uint64 {
+	switch i := v.(type) {
+	case nil:
+		return 0
+	case uint64:
+		return i
+	}
+	d.fail("unsigned integer")
+	return 0
+}
+
+// bytes function converts the provided data item into a byte slice.
+func (d *cborDecoder) bytes(v interface{}) []byte {
+	switch b := v.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return b
+	}
+	d.fail("byte string")
+	return nil
+}
+
+// string function converts the provided data item into a string.
+func (d *cborDecoder) string(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	}
+	d.fail("text string")
+	return ""
+}
+
+// bool function converts the provided data item into a boolean.
+func (d *cborDecoder) bool(v interface{}) bool {
+	switch b := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return b
+	}
+	d.fail("boolean")
+	return false
+}
+
+// array function converts the provided data item into a list of data items.
+func (d *cborDecoder) array(v interface{}) []interface{} {
+	switch items := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return items
+	}
+	d.fail("array")
+	return nil
+}
+
+// object function converts the provided data item into the entries of a map.
+func (d *cborDecoder) object(v interface{}) map[string]interface{} {
+	switch entries := v.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		return entries
+	}
+	d.fail("map")
+	return nil
+}
+
+// message function converts the provided data item into a message.
+func (d *cborDecoder) message(v interface{}) *Message {
+	entries := d.object(v)
+	if entries == nil {
+		d.fail("map")
+		return nil
+	}
+
+	msg := &Message{
+		ID:        d.string(entries["id"]),
+		Timestamp: d.int(entries["timestamp"]),
+		Type:      int(d.int(entries["type"])),
+		TTL:       int(d.int(entries["ttl"])),
+		Topic:     d.string(entries["topic"]),
+		ReplyTo:   d.string(entries["reply_to"]),
+		Chunk:     d.chunk(entries["chunk"]),
+		Data:      d.bytes(entries["data"]),
+		Encrypted: d.bool(entries["encrypted"]),
+		Error:     d.string(entries["error"]),
+		From:      d.peer(entries["from"]),
+		Signature: d.bytes(entries["signature"]),
+	}
+	if to := d.array(entries["to"]); to != nil {
+		msg.To = make([]*peer.Peer, len(to))
+		for i, p := range to {
+			msg.To[i] = d.peer(p)
+		}
+	}
+	if updates := d.array(entries["updates"]); updates != nil {
+		msg.Updates = make([]*peer.Update, len(updates))
+		for i, update := range updates {
+			msg.Updates[i] = d.update(update)
+		}
+	}
+	return msg
+}
+
+// chunk function converts the provided data item into a chunk position.
+func (d *cborDecoder) chunk(v interface{}) *Chunk {
+	entries := d.object(v)
+	if entries == nil {
+		return nil
+	}
+	return &Chunk{
+		Stream: d.string(entries["stream"]),
+		Seq:    d.uint(entries["seq"]),
+		Name:   d.string(entries["name"]),
+		Size:   d.int(entries["size"]),
+		Final:  d.bool(entries["final"]),
+		Hash:   d.bytes(entries["hash"]),
+	}
+}
+
+// peer function converts the provided data item into a peer.
+func (d *cborDecoder) peer(v interface{}) *peer.Peer {
+	entries := d.object(v)
+	if entries == nil {
+		return nil
+	}
+
+	p := &peer.Peer{
+		Port:          int(d.int(entries["port"])),
+		Address:       d.string(entries["address"]),
+		PublicKey:     ed25519.PublicKey(d.bytes(entries["key"])),
+		EncryptionKey: d.bytes(entries["encryption_key"]),
+		Relay:         d.peer(entries["relay"]),
+	}
+	if metadata := d.object(entries["metadata"]); metadata != nil {
+		p.Metadata = make(map[string]string, len(metadata))
+		for key, value := range metadata {
+			p.Metadata[key] = d.string(value)
+		}
+	}
+	return p
+}
+
+// update function converts the provided data item into a membership update.
+func (d *cborDecoder) update(v interface{}) *peer.Update {
+	entries := d.object(v)
+	if entries == nil {
+		return nil
+	}
+	return &peer.Update{
+		Peer:        d.peer(entries["peer"]),
+		State:       peer.State(d.int(entries["state"])),
+		Incarnation: d.uint(entries["incarnation"]),
+	}
+}
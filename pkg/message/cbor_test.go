@@ -0,0 +1,92 @@
+package message
+
+import (
+	"encoding/hex"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func Test_cborWriter(t *testing.T) {
+	c := qt.New(t)
+
+	// Examples of RFC 8949, Appendix A
+	examples := []struct {
+		write    func(w *cborWriter)
+		expected string
+	}{
+		{func(w *cborWriter) { w.uint(0) }, "00"},
+		{func(w *cborWriter) { w.uint(23) }, "17"},
+		{func(w *cborWriter) { w.uint(24) }, "1818"},
+		{func(w *cborWriter) { w.uint(1000) }, "1903e8"},
+		{func(w *cborWriter) { w.uint(1000000) }, "1a000f4240"},
+		{func(w *cborWriter) { w.uint(1000000000000) }, "1b000000e8d4a51000"},
+		{func(w *cborWriter) { w.int(-1) }, "20"},
+		{func(w *cborWriter) { w.int(-1000) }, "3903e7"},
+		{func(w *cborWriter) { w.bytes([]byte{1, 2, 3, 4}) }, "4401020304"},
+		{func(w *cborWriter) { w.bytes(nil) }, "f6"},
+		{func(w *cborWriter) { w.string("") }, "60"},
+		{func(w *cborWriter) { w.string("IETF") }, "6449455446"},
+		{func(w *cborWriter) { w.bool(false) }, "f4"},
+		{func(w *cborWriter) { w.bool(true) }, "f5"},
+		{func(w *cborWriter) {
+			w.object(func(o *cborObject) {
+				o.key("a").uint(1)
+				o.key("b").head(cborArray, 2)
+				o.uint(2)
+				o.uint(3)
+			})
+		}, "a26161016162820203"},
+	}
+	for _, example := range examples {
+		w := &cborWriter{}
+		example.write(w)
+		c.Assert(hex.EncodeToString(w.buf), qt.Equals, example.expected)
+	}
+}
+
+func Test_cborReader(t *testing.T) {
+	c := qt.New(t)
+
+	// Examples of RFC 8949, Appendix A
+	examples := []struct {
+		data     string
+		expected interface{}
+	}{
+		{"00", uint64(0)},
+		{"1bffffffffffffffff", uint64(18446744073709551615)},
+		{"3903e7", int64(-1000)},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"6449455446", "IETF"},
+		{"f4", false},
+		{"f6", nil},
+		{"f7", nil},
+		{"83010203", []interface{}{uint64(1), uint64(2), uint64(3)}},
+		{"a26161016162820203", map[string]interface{}{"a": uint64(1), "b": []interface{}{uint64(2), uint64(3)}}},
+		{"c11a514b67b0", uint64(1363896240)},
+	}
+	for _, example := range examples {
+		data, _ := hex.DecodeString(example.data)
+		r := &cborReader{buf: data}
+		result, err := r.value()
+		c.Assert(err, qt.IsNil)
+		c.Assert(result, qt.DeepEquals, example.expected)
+		c.Assert(r.buf, qt.HasLen, 0)
+	}
+
+	// Floats, indefinite lengths, non-text keys, negative integers
+	// overflows, invalid text strings, too deep or truncated items are not
+	// supported
+	for _, example := range []string{"f93c00", "5f42010243030405ff", "a10102",
+		"3bffffffffffffffff", "62c328", "1903", "4401", "8301"} {
+		data, _ := hex.DecodeString(example)
+		_, err := (&cborReader{buf: data}).value()
+		c.Assert(err, qt.IsNotNil, qt.Commentf(example))
+	}
+	deep := make([]byte, maxCBORDepth+1)
+	for i := range deep {
+		deep[i] = 0x81
+	}
+	_, err := (&cborReader{buf: append(deep, 0x00)}).value()
+	c.Assert(err, qt.ErrorMatches, "CBOR message too deep")
+}
@@ -0,0 +1,110 @@
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Codec interface abstracts the format used to encode the messages exchanged
+// by the peers. Every codec is identified by the content type of the messages
+// encoded with it, that the transports use to negotiate the codec with every
+// peer.
+type Codec interface {
+	// ContentType function returns the media type of the messages encoded
+	// by the codec.
+	ContentType() string
+	// Marshal function encodes the provided message.
+	Marshal(msg *Message) ([]byte, error)
+	// Unmarshal function decodes the provided data into the message
+	// provided.
+	Unmarshal(data []byte, msg *Message) error
+}
+
+var (
+	// JSONCodec encodes the messages as JSON. It is the default codec, that
+	// every peer supports.
+	JSONCodec Codec = jsonCodec{}
+	// CBORCodec encodes the messages as CBOR, a standard binary format that
+	// includes the data and the rest of byte fields without inflating them.
+	CBORCodec Codec = cborCodec{}
+)
+
+// Encode function encodes the current message with the provided codec and
+// returns the result, or nil if the message has no sender or it can not be
+// encoded.
+func (msg *Message) Encode(codec Codec) []byte {
+	if msg.From == nil || msg.From.Address == "" || msg.From.Port == 0 {
+		return nil
+	}
+
+	result, err := codec.Marshal(msg)
+	if err != nil {
+		return nil
+	}
+	return result
+}
+
+// Decode function decodes the provided data with the provided codec into the
+// current message and returns it, or nil if the data can not be decoded.
+func (msg *Message) Decode(codec Codec, data []byte) *Message {
+	if err := codec.Unmarshal(data, msg); err != nil {
+		return nil
+	}
+	return msg
+}
+
+// jsonCodec struct implements the Codec interface using encoding/json.
+type jsonCodec struct{}
+
+// ContentType function returns the JSON media type.
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+// Marshal function encodes the provided message as JSON.
+func (jsonCodec) Marshal(msg *Message) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+// Unmarshal function decodes the provided JSON into the message provided.
+func (jsonCodec) Unmarshal(data []byte, msg *Message) error {
+	return json.Unmarshal(data, msg)
+}
+
+// cborCodec struct implements the Codec interface encoding the messages as
+// CBOR (RFC 8949), with the same structure as the JSON encoding, so any CBOR
+// implementation can decode them.
+type cborCodec struct{}
+
+// ContentType function returns the CBOR media type.
+func (cborCodec) ContentType() string {
+	return "application/cbor"
+}
+
+// Marshal function encodes the provided message as CBOR.
+func (cborCodec) Marshal(msg *Message) ([]byte, error) {
+	w := &cborWriter{}
+	w.message(msg)
+	return w.buf, nil
+}
+
+// Unmarshal function decodes the provided CBOR into the message provided. It
+// returns an error if the data is malformed or it includes data items not
+// supported.
+func (cborCodec) Unmarshal(data []byte, msg *Message) error {
+	r := &cborReader{buf: data}
+	v, err := r.value()
+	if err != nil {
+		return err
+	} else if len(r.buf) > 0 {
+		return fmt.Errorf("unexpected trailing data")
+	}
+
+	d := &cborDecoder{}
+	decoded := d.message(v)
+	if d.err != nil {
+		return d.err
+	}
+	*msg = *decoded
+	return nil
+}
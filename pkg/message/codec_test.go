@@ -0,0 +1,61 @@
+package message
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+)
+
+func TestCodecs(t *testing.T) {
+	c := qt.New(t)
+
+	pubKey, privKey, _ := ed25519.GenerateKey(nil)
+	from, _ := peer.Me(5000, false)
+	from.PublicKey = pubKey
+	from.Metadata = map[string]string{"role": "builder"}
+	to, _ := peer.Me(5001, false)
+
+	msg := new(Message).SetFrom(from).SetData(bytes.Repeat([]byte{0xff}, 1024)).SetTo(to).Stamp()
+	msg.TTL, msg.Topic, msg.ReplyTo, msg.Error = 3, "jobs", "request", "failed"
+	msg.Chunk = &Chunk{Stream: "stream", Seq: 2, Name: "file", Size: 2048, Final: true, Hash: []byte("hash")}
+	msg.Updates = []*peer.Update{{Peer: to, State: peer.Suspect, Incarnation: 1}}
+	msg.Sign(privKey)
+
+	for _, codec := range []Codec{JSONCodec, CBORCodec} {
+		// Every field and the signature survive the encoding
+		decoded := new(Message).Decode(codec, msg.Encode(codec))
+		c.Assert(decoded, qt.IsNotNil)
+		c.Assert(decoded, qt.DeepEquals, msg)
+		c.Assert(decoded.Verify(pubKey), qt.IsTrue)
+
+		// Messages without sender are not encoded
+		c.Assert(new(Message).SetData([]byte("test")).Encode(codec), qt.IsNil)
+		c.Assert(new(Message).Decode(codec, []byte("malformed")), qt.IsNil)
+	}
+
+	// The CBOR codec does not inflate the data
+	c.Assert(len(msg.Encode(CBORCodec)) < len(msg.Encode(JSONCodec))-256, qt.IsTrue)
+
+	// Truncated or extended CBOR messages are rejected
+	encoded := msg.Encode(CBORCodec)
+	c.Assert(new(Message).Decode(CBORCodec, encoded[:len(encoded)-1]), qt.IsNil)
+	c.Assert(new(Message).Decode(CBORCodec, append(encoded, 0)), qt.IsNil)
+	c.Assert(new(Message).Decode(CBORCodec, nil), qt.IsNil)
+
+	// The messages encoded by other CBOR implementations are decoded:
+	// {"type": 2, "data": h'74657374', "from": {"port": 5000, "address": "localhost"}}
+	external, _ := hex.DecodeString("a3" + "647479706502" + "64646174614474657374" +
+		"6466726f6d" + "a2" + "64706f7274191388" + "6761646472657373696c6f63616c686f7374")
+	decoded := new(Message).Decode(CBORCodec, external)
+	c.Assert(decoded, qt.IsNotNil)
+	c.Assert(decoded.Type, qt.Equals, BroadcastType)
+	c.Assert(decoded.Data, qt.DeepEquals, []byte("test"))
+	c.Assert(decoded.From, qt.DeepEquals, &peer.Peer{Address: "localhost", Port: 5000})
+
+	// The fields with unexpected types are rejected: {"type": "2"}
+	c.Assert(new(Message).Decode(CBORCodec, []byte{0xa1, 0x64, 't', 'y', 'p', 'e', 0x61, '2'}), qt.IsNil)
+}
@@ -0,0 +1,101 @@
+package message
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+)
+
+// encryptionKeySize contains the size of the X25519 public keys.
+const encryptionKeySize = 32
+
+// Encrypt function encrypts the current message data for the owner of the
+// provided X25519 public key, marks the message as encrypted and returns it.
+// It generates an ephemeral X25519 key to agree a shared secret with the
+// recipient, derives an AES-256-GCM key from it, and replaces the data with
+// the ephemeral public key, the nonce and the ciphertext. The message must be
+// signed after encrypting it.
+func (msg *Message) Encrypt(to []byte) (*Message, error) {
+	if msg.Encrypted {
+		return nil, fmt.Errorf("message already encrypted")
+	}
+	recipient, err := ecdh.X25519().NewPublicKey(to)
+	if err != nil {
+		return nil, fmt.Errorf("no valid encryption key provided: %w", err)
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := encryptionCipher(ephemeral, recipient, ephemeral.PublicKey(), recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	data := append(ephemeral.PublicKey().Bytes(), nonce...)
+	msg.Data = aead.Seal(data, nonce, msg.Data, nil)
+	msg.Encrypted = true
+	return msg, nil
+}
+
+// Decrypt function decrypts the current message data using the provided X25519
+// private key, marks the message as not encrypted and returns it. It returns
+// an error if the message is not encrypted or it can not be decrypted.
+func (msg *Message) Decrypt(key *ecdh.PrivateKey) (*Message, error) {
+	if !msg.Encrypted {
+		return nil, fmt.Errorf("message not encrypted")
+	}
+
+	if len(msg.Data) < encryptionKeySize {
+		return nil, fmt.Errorf("encrypted data too short")
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(msg.Data[:encryptionKeySize])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := encryptionCipher(key, ephemeral, ephemeral, key.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+	if len(msg.Data) < encryptionKeySize+aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("encrypted data too short")
+	}
+
+	nonce := msg.Data[encryptionKeySize : encryptionKeySize+aead.NonceSize()]
+	ciphertext := msg.Data[encryptionKeySize+aead.NonceSize():]
+	data, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting message data: %w", err)
+	}
+	msg.Data = data
+	msg.Encrypted = false
+	return msg, nil
+}
+
+// encryptionCipher function agrees the shared secret between the private and
+// public keys provided and returns the AES-256-GCM cipher with the key derived
+// from it, the ephemeral public key and the recipient public key.
+func encryptionCipher(private *ecdh.PrivateKey, public, ephemeral, recipient *ecdh.PublicKey) (cipher.AEAD, error) {
+	secret, err := private.ECDH(public)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	hash.Write(secret)
+	hash.Write(ephemeral.Bytes())
+	hash.Write(recipient.Bytes())
+	block, err := aes.NewCipher(hash.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,51 @@
+package message
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestMessageEncryptDecrypt(t *testing.T) {
+	c := qt.New(t)
+
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	c.Assert(err, qt.IsNil)
+	otherKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	c.Assert(err, qt.IsNil)
+
+	data := []byte("secret")
+	msg := new(Message).SetData(data)
+	_, err = msg.Decrypt(key)
+	c.Assert(err, qt.IsNotNil)
+	_, err = msg.Encrypt([]byte("short"))
+	c.Assert(err, qt.IsNotNil)
+
+	_, err = msg.Encrypt(key.PublicKey().Bytes())
+	c.Assert(err, qt.IsNil)
+	c.Assert(msg.Encrypted, qt.IsTrue)
+	c.Assert(msg.Data, qt.Not(qt.DeepEquals), data)
+	_, err = msg.Encrypt(key.PublicKey().Bytes())
+	c.Assert(err, qt.IsNotNil)
+
+	// Other keys can not decrypt it
+	encrypted := append([]byte{}, msg.Data...)
+	_, err = msg.Decrypt(otherKey)
+	c.Assert(err, qt.IsNotNil)
+
+	// Tampered data can not be decrypted
+	msg.Data[len(msg.Data)-1] ^= 0xff
+	_, err = msg.Decrypt(key)
+	c.Assert(err, qt.IsNotNil)
+	msg.Data = encrypted[:10]
+	_, err = msg.Decrypt(key)
+	c.Assert(err, qt.IsNotNil)
+
+	msg.Data = encrypted
+	_, err = msg.Decrypt(key)
+	c.Assert(err, qt.IsNil)
+	c.Assert(msg.Encrypted, qt.IsFalse)
+	c.Assert(msg.Data, qt.DeepEquals, data)
+}
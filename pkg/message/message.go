@@ -7,12 +7,17 @@ package message
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/lucasmenendez/gop2p/pkg/peer"
 )
@@ -29,6 +34,44 @@ const (
 	// DirectType identifies a message that is intended for a single network
 	// peer (such as direct message).
 	DirectType = iota
+	// SessionType identifies a message that belongs to a secure session
+	// between two peers, such as a handshake message or an encrypted message
+	// that wraps other one. It is handled by the transport.Secure transport
+	// and it is never delivered to the node.
+	SessionType = iota
+	// PingType identifies a message that probes if a network member is alive,
+	// used by the failure detection.
+	PingType = iota
+	// PingReqType identifies a message that requests to a network member to
+	// probe other one on behalf of the sender, used by the failure detection
+	// when the sender can not reach it directly.
+	PingReqType = iota
+	// GossipType identifies a message that wraps a broadcast message to
+	// disseminate it epidemically: every peer that receives it forwards it to
+	// a random subset of peers until its TTL expires.
+	GossipType = iota
+	// SubscribeType identifies a message that announces the topics to which
+	// a peer is subscribed, replacing the previous ones.
+	SubscribeType = iota
+	// PublishType identifies a message published to a topic, that is sent
+	// only to the peers subscribed to it.
+	PublishType = iota
+	// RequestType identifies a message that requests a response to a network
+	// peer, that is returned to the sender as a ResponseType message.
+	RequestType = iota
+	// ResponseType identifies the response to a RequestType message, that
+	// refers to the request by its ID.
+	ResponseType = iota
+	// CallType identifies a request that calls a method of a service
+	// registered by a network peer, that is responded as a ResponseType
+	// message.
+	CallType = iota
+	// ChunkType identifies a message that contains a chunk of a stream sent
+	// to a network peer.
+	ChunkType = iota
+	// BlobType identifies a message that announces, or requests to a network
+	// peer, a blob identified by the hash of its content.
+	BlobType = iota
 )
 
 const (
@@ -44,14 +87,66 @@ const (
 	fromParameter string = "from"
 )
 
+// Priority type defines the order in which the messages queued to be sent to a
+// peer are sent: the control messages first, then the data messages and, at
+// last, the bulk ones.
+type Priority int
+
+const (
+	// DataPriority identifies the regular messages, it is the default one.
+	DataPriority Priority = iota
+	// ControlPriority identifies the messages that must be sent before any
+	// data message, such as the membership ones.
+	ControlPriority Priority = iota
+	// BulkPriority identifies the large or not urgent messages, that are
+	// sent after any other message.
+	BulkPriority Priority = iota
+)
+
+// Chunk struct contains the position of the data of a message into a stream:
+// the ID of the stream and the sequence number of the chunk. The first chunk
+// includes the name and the size of the stream (if they are known), and the
+// final one includes its SHA-256 hash to verify it.
+type Chunk struct {
+	Stream string `json:"stream"`
+	Seq    uint64 `json:"seq"`
+	Name   string `json:"name,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	Final  bool   `json:"final,omitempty"`
+	Hash   []byte `json:"hash,omitempty"`
+}
+
 // Message struct includes the content of a Message and it is transferred
 // between peers. It contains its type as integer (checkout defined types),
 // the information about the message sender and the content of the message.
+// If the sender has identity, it also contains the signature of the message
+// with the sender private key. If the data is encrypted for the recipient,
+// the message is marked as Encrypted. Any message can piggyback membership
+// updates to disseminate them through the network. The sender identifies every
+// message with an unique ID and its creation Timestamp (in Unix nanoseconds),
+// that allow to the receivers to discard duplicated messages. If the TTL of a
+// broadcast message is set, it is disseminated epidemically through up to TTL
+// hops instead of sent directly to every peer. The messages published to a
+// topic contain the name of the Topic. The responses to a request refer to it
+// by its ID in ReplyTo, and contain the Error of the request if it fails. The
+// Priority of the message is not transferred, it only sorts the messages
+// queued by the sender. The messages of a stream contain its Chunk position.
 type Message struct {
-	Type int          `json:"type"`
-	Data []byte       `json:"data"`
-	From *peer.Peer   `json:"from"`
-	To   []*peer.Peer `json:"to,omitempty"`
+	ID        string         `json:"id,omitempty"`
+	Timestamp int64          `json:"timestamp,omitempty"`
+	Type      int            `json:"type"`
+	TTL       int            `json:"ttl,omitempty"`
+	Topic     string         `json:"topic,omitempty"`
+	ReplyTo   string         `json:"reply_to,omitempty"`
+	Chunk     *Chunk         `json:"chunk,omitempty"`
+	Data      []byte         `json:"data"`
+	Encrypted bool           `json:"encrypted,omitempty"`
+	Error     string         `json:"error,omitempty"`
+	From      *peer.Peer     `json:"from"`
+	To        []*peer.Peer   `json:"to,omitempty"`
+	Updates   []*peer.Update `json:"updates,omitempty"`
+	Signature []byte         `json:"signature,omitempty"`
+	Priority  Priority       `json:"-"`
 }
 
 // SetType function sets the type of the current message to the provided one,
@@ -59,7 +154,10 @@ type Message struct {
 // BroadcastType, unless other valid type has been provided by argument.
 func (msg *Message) SetType(t int) *Message {
 	msg.Type = BroadcastType
-	if t == ConnectType || t == DisconnectType || t == DirectType {
+	if t == ConnectType || t == DisconnectType || t == DirectType ||
+		t == PingType || t == PingReqType || t == GossipType ||
+		t == SubscribeType || t == PublishType || t == RequestType ||
+		t == ResponseType || t == CallType || t == ChunkType || t == BlobType {
 		msg.Type = t
 	}
 
@@ -91,31 +189,134 @@ func (msg *Message) SetData(data []byte) *Message {
 	return msg
 }
 
+// SetPriority function sets the provided priority to the current message, and
+// returns it as result. By default, the priority will be DataPriority, unless
+// other valid priority has been provided by argument.
+func (msg *Message) SetPriority(p Priority) *Message {
+	msg.Priority = DataPriority
+	if p == ControlPriority || p == BulkPriority {
+		msg.Priority = p
+	}
+	return msg
+}
+
+// Stamp function identifies the current message with a new random ID and sets
+// its creation timestamp to the current time, unless it already has an ID, and
+// returns it. The message must be stamped before signing it.
+func (msg *Message) Stamp() *Message {
+	if msg.ID != "" {
+		return msg
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return msg
+	}
+	msg.ID = hex.EncodeToString(id)
+	msg.Timestamp = time.Now().UnixNano()
+	return msg
+}
+
 // String function returns a human-readable version of Message struct following
 // the format: '[from.address:from.port] data'.
 func (msg *Message) String() string {
 	return fmt.Sprintf("[%s] %s", msg.From.String(), string(msg.Data))
 }
 
-func (msg *Message) JSON() []byte {
-	if msg.From == nil || msg.From.Address == "" || msg.From.Port == 0 {
-		return nil
+// Sign function signs the current message with the provided private key,
+// sets the result as the message signature and returns the message. The
+// signature covers the message type, data, sender and recipients, so the
+// message must be signed after setting them.
+func (msg *Message) Sign(key ed25519.PrivateKey) *Message {
+	msg.Signature = ed25519.Sign(key, msg.signingPayload())
+	return msg
+}
+
+// Verify function returns if the current message signature is valid for the
+// provided public key.
+func (msg *Message) Verify(key ed25519.PublicKey) bool {
+	if len(key) != ed25519.PublicKeySize || msg.Signature == nil {
+		return false
 	}
+	return ed25519.Verify(key, msg.signingPayload(), msg.Signature)
+}
 
-	result, err := json.Marshal(msg)
-	if err != nil {
-		return nil
+// signingPayload function returns the content of the current message covered
+// by its signature: the type, the TTL, the topic, the request that it replies
+// and its error, the chunk position, the data (and if it is encrypted), the ID
+// and the timestamp, the sender and the recipients (their public keys,
+// addresses and metadata) and the membership updates piggybacked. Every field
+// is written in this fixed order prefixed by its length, even if it is empty,
+// so different messages never produce the same payload.
+func (msg *Message) signingPayload() []byte {
+	payload := []byte{}
+	field := func(value []byte) {
+		payload = binary.BigEndian.AppendUint32(payload, uint32(len(value)))
+		payload = append(payload, value...)
+	}
+	number := func(value int64) {
+		field(binary.BigEndian.AppendUint64(nil, uint64(value)))
+	}
+	flag := func(value bool) {
+		if value {
+			field([]byte{1})
+		} else {
+			field([]byte{0})
+		}
+	}
+	member := func(p *peer.Peer) {
+		flag(p != nil)
+		if p == nil {
+			return
+		}
+		field(p.PublicKey)
+		field(p.EncryptionKey)
+		field([]byte(p.String()))
+		var metadata []byte
+		if len(p.Metadata) > 0 {
+			// The keys of the map are encoded sorted.
+			metadata, _ = json.Marshal(p.Metadata)
+		}
+		field(metadata)
 	}
 
-	return result
+	number(int64(msg.Type))
+	number(int64(msg.TTL))
+	field([]byte(msg.Topic))
+	field([]byte(msg.ReplyTo))
+	field([]byte(msg.Error))
+	var chunk []byte
+	if msg.Chunk != nil {
+		chunk, _ = json.Marshal(msg.Chunk)
+	}
+	field(chunk)
+	field(msg.Data)
+	flag(msg.Encrypted)
+	field([]byte(msg.ID))
+	number(msg.Timestamp)
+	member(msg.From)
+	number(int64(len(msg.To)))
+	for _, p := range msg.To {
+		member(p)
+	}
+	var updates []byte
+	if len(msg.Updates) > 0 {
+		updates, _ = json.Marshal(msg.Updates)
+	}
+	field(updates)
+	return payload
 }
 
-func (msg *Message) SetJSON(data []byte) *Message {
-	if err := json.Unmarshal(data, msg); err != nil {
-		return nil
-	}
+// JSON function encodes the current message as JSON and returns the result,
+// or nil if the message has no sender or it can not be encoded.
+func (msg *Message) JSON() []byte {
+	return msg.Encode(JSONCodec)
+}
 
-	return msg
+// SetJSON function decodes the provided JSON into the current message and
+// returns it, or nil if the JSON can not be decoded.
+func (msg *Message) SetJSON(data []byte) *Message {
+	return msg.Decode(JSONCodec, data)
 }
 
 // GetRequest function generates a http.Request to the provided uri endpoint
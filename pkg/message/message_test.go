@@ -2,6 +2,8 @@ package message
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
 	"fmt"
 	"net/http"
 	"testing"
@@ -26,10 +28,54 @@ func TestMessageSetType(t *testing.T) {
 	msg.SetType(DirectType)
 	c.Assert(msg.Type, qt.Equals, DirectType)
 
+	msg.SetType(PingType)
+	c.Assert(msg.Type, qt.Equals, PingType)
+
+	msg.SetType(PingReqType)
+	c.Assert(msg.Type, qt.Equals, PingReqType)
+
+	msg.SetType(GossipType)
+	c.Assert(msg.Type, qt.Equals, GossipType)
+
+	msg.SetType(SubscribeType)
+	c.Assert(msg.Type, qt.Equals, SubscribeType)
+
+	msg.SetType(PublishType)
+	c.Assert(msg.Type, qt.Equals, PublishType)
+
+	msg.SetType(RequestType)
+	c.Assert(msg.Type, qt.Equals, RequestType)
+
+	msg.SetType(ResponseType)
+	c.Assert(msg.Type, qt.Equals, ResponseType)
+
+	msg.SetType(CallType)
+	c.Assert(msg.Type, qt.Equals, CallType)
+
+	msg.SetType(ChunkType)
+	c.Assert(msg.Type, qt.Equals, ChunkType)
+
+	msg.SetType(BlobType)
+	c.Assert(msg.Type, qt.Equals, BlobType)
+
 	msg.SetType(-1)
 	c.Assert(msg.Type, qt.Equals, BroadcastType)
 }
 
+func TestMessageSetPriority(t *testing.T) {
+	c := qt.New(t)
+
+	msg := new(Message)
+	c.Assert(msg.Priority, qt.Equals, DataPriority)
+	c.Assert(msg.SetPriority(BulkPriority).Priority, qt.Equals, BulkPriority)
+	c.Assert(msg.SetPriority(ControlPriority).Priority, qt.Equals, ControlPriority)
+	c.Assert(msg.SetPriority(-1).Priority, qt.Equals, DataPriority)
+
+	// The priority is not transferred
+	msg.SetFrom(&peer.Peer{Address: "localhost", Port: 5000}).SetPriority(BulkPriority)
+	c.Assert(new(Message).SetJSON(msg.JSON()).Priority, qt.Equals, DataPriority)
+}
+
 func TestMessageSetFrom(t *testing.T) {
 	c := qt.New(t)
 
@@ -70,6 +116,20 @@ func TestMessageSetData(t *testing.T) {
 	c.Assert(msg.Type, qt.Equals, BroadcastType)
 }
 
+func TestMessageStamp(t *testing.T) {
+	c := qt.New(t)
+
+	msg := new(Message).Stamp()
+	c.Assert(msg.ID, qt.HasLen, 32)
+	c.Assert(msg.Timestamp > 0, qt.IsTrue)
+
+	// Stamped messages keep their ID
+	id, timestamp := msg.ID, msg.Timestamp
+	c.Assert(msg.Stamp().ID, qt.Equals, id)
+	c.Assert(msg.Timestamp, qt.Equals, timestamp)
+	c.Assert(new(Message).Stamp().ID, qt.Not(qt.Equals), id)
+}
+
 func TestMessageGetRequest(t *testing.T) {
 	c := qt.New(t)
 
@@ -131,3 +191,75 @@ func TestMessageFromRequest(t *testing.T) {
 	c.Assert(expected.From.Equal(result.From), qt.IsTrue)
 	c.Assert(result.Data, qt.DeepEquals, expected.Data)
 }
+
+func TestMessageSignVerify(t *testing.T) {
+	c := qt.New(t)
+
+	pubKey, privKey, _ := ed25519.GenerateKey(nil)
+	otherKey, _, _ := ed25519.GenerateKey(nil)
+	from, _ := peer.Me(5000, false)
+	from.PublicKey = pubKey
+	to, _ := peer.Me(5001, false)
+
+	msg := new(Message).SetFrom(from).SetData([]byte("test"))
+	c.Assert(msg.Verify(pubKey), qt.IsFalse)
+	msg.Sign(privKey)
+	c.Assert(msg.Verify(pubKey), qt.IsTrue)
+	c.Assert(msg.Verify(otherKey), qt.IsFalse)
+	c.Assert(msg.Verify(nil), qt.IsFalse)
+
+	// The signature survives the encoding
+	decoded := new(Message).SetJSON(msg.JSON())
+	c.Assert(decoded.Verify(pubKey), qt.IsTrue)
+
+	// Every signed field invalidates the signature if it changes
+	decoded.Data = []byte("other")
+	c.Assert(decoded.Verify(pubKey), qt.IsFalse)
+	decoded = new(Message).SetJSON(msg.JSON())
+	decoded.Type = DirectType
+	c.Assert(decoded.Verify(pubKey), qt.IsFalse)
+	decoded = new(Message).SetJSON(msg.JSON())
+	decoded.From.Port = 5002
+	c.Assert(decoded.Verify(pubKey), qt.IsFalse)
+	decoded = new(Message).SetJSON(msg.JSON())
+	decoded.To = []*peer.Peer{to}
+	c.Assert(decoded.Verify(pubKey), qt.IsFalse)
+	decoded = new(Message).SetJSON(msg.JSON())
+	decoded.Stamp()
+	c.Assert(decoded.Verify(pubKey), qt.IsFalse)
+	decoded = new(Message).SetJSON(msg.JSON())
+	decoded.From.Metadata = map[string]string{"role": "admin"}
+	c.Assert(decoded.Verify(pubKey), qt.IsFalse)
+	decoded = new(Message).SetJSON(msg.JSON())
+	decoded.Updates = []*peer.Update{{Peer: to, State: peer.Failed}}
+	c.Assert(decoded.Verify(pubKey), qt.IsFalse)
+	decoded = new(Message).SetJSON(msg.JSON())
+	decoded.TTL = 5
+	c.Assert(decoded.Verify(pubKey), qt.IsFalse)
+	decoded = new(Message).SetJSON(msg.JSON())
+	decoded.Topic = "other"
+	c.Assert(decoded.Verify(pubKey), qt.IsFalse)
+	decoded = new(Message).SetJSON(msg.JSON())
+	decoded.Error = "forged"
+	c.Assert(decoded.Verify(pubKey), qt.IsFalse)
+	decoded = new(Message).SetJSON(msg.JSON())
+	decoded.Chunk = &Chunk{Stream: "stream", Seq: 1}
+	c.Assert(decoded.Verify(pubKey), qt.IsFalse)
+
+	// The signature of a field is not valid for other field with the same
+	// content
+	ttl := new(Message).SetFrom(from).SetData([]byte("test"))
+	ttl.TTL = 5
+	ttl.Sign(privKey)
+	topic := new(Message).SetFrom(from).SetData([]byte("test"))
+	topic.Topic = string(binary.BigEndian.AppendUint64(nil, 5))
+	topic.Signature = ttl.Signature
+	c.Assert(topic.Verify(pubKey), qt.IsFalse)
+	reply := new(Message).SetFrom(from).SetData([]byte("test"))
+	reply.ReplyTo = "request"
+	reply.Sign(privKey)
+	failed := new(Message).SetFrom(from).SetData([]byte("test"))
+	failed.Error = "request"
+	failed.Signature = reply.Signature
+	c.Assert(failed.Verify(pubKey), qt.IsFalse)
+}
@@ -0,0 +1,133 @@
+// nettest package provides an in-process virtual network to test gop2p nodes
+// without touching the OS network stack. Every node of the network uses a
+// Transport created by the Network, that delivers the messages to the
+// destination transport through channels. The Network allows to simulate
+// latency, message losses and network partitions in a reproducible way.
+package nettest
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+)
+
+var (
+	// ErrUnreachable is returned when the destination peer is not listening
+	// on the network or it is in a different partition than the sender.
+	ErrUnreachable = fmt.Errorf("peer unreachable")
+	// ErrDropped is returned when the network drops the message sent.
+	ErrDropped = fmt.Errorf("message dropped")
+)
+
+// Network struct contains the transports listening on the virtual network,
+// indexed by the string version of its peer, and the configuration of the
+// conditions simulated: latency, drop rate and partitions. The drop rate uses
+// a random source initialized with a seed to make the tests reproducible.
+type Network struct {
+	mtx        *sync.Mutex
+	transports map[string]*Transport
+	partitions map[string]int
+	latency    time.Duration
+	dropRate   float64
+	rand       *rand.Rand
+}
+
+// NewNetwork function creates a new virtual network without latency, drops or
+// partitions, using the provided seed to initialize its random source.
+func NewNetwork(seed int64) *Network {
+	return &Network{
+		mtx:        &sync.Mutex{},
+		transports: map[string]*Transport{},
+		partitions: map[string]int{},
+		latency:    0,
+		dropRate:   0,
+		rand:       rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Transport function creates a new Transport attached to the current network
+// and returns it.
+func (net *Network) Transport() *Transport {
+	return &Transport{network: net, mtx: &sync.Mutex{}}
+}
+
+// SetLatency function sets the time that every message takes to be delivered
+// to its destination.
+func (net *Network) SetLatency(latency time.Duration) {
+	net.mtx.Lock()
+	defer net.mtx.Unlock()
+	net.latency = latency
+}
+
+// SetDropRate function sets the probability (between 0 and 1) of a message to
+// be dropped by the network.
+func (net *Network) SetDropRate(rate float64) {
+	net.mtx.Lock()
+	defer net.mtx.Unlock()
+	net.dropRate = rate
+}
+
+// Partition function splits the network into the provided groups of peers.
+// Peers of different groups can not communicate until the network is healed.
+// Peers not included in any group keep in a common default group.
+func (net *Network) Partition(groups ...[]*peer.Peer) {
+	net.mtx.Lock()
+	defer net.mtx.Unlock()
+
+	net.partitions = map[string]int{}
+	for i, group := range groups {
+		for _, p := range group {
+			net.partitions[p.String()] = i + 1
+		}
+	}
+}
+
+// Heal function removes every partition of the network.
+func (net *Network) Heal() {
+	net.mtx.Lock()
+	defer net.mtx.Unlock()
+	net.partitions = map[string]int{}
+}
+
+// register function attaches the provided transport to the network listening
+// on the provided peer. It returns an error if other transport is already
+// listening on the same peer.
+func (net *Network) register(self *peer.Peer, t *Transport) error {
+	net.mtx.Lock()
+	defer net.mtx.Unlock()
+
+	if _, exists := net.transports[self.String()]; exists {
+		return fmt.Errorf("address %s already in use", self)
+	}
+	net.transports[self.String()] = t
+	return nil
+}
+
+// unregister function detaches the transport listening on the provided peer.
+func (net *Network) unregister(self *peer.Peer) {
+	net.mtx.Lock()
+	defer net.mtx.Unlock()
+	delete(net.transports, self.String())
+}
+
+// route function returns the transport listening on the destination peer
+// provided, and the latency to wait before delivering the message. It returns
+// an error if the message is dropped or the destination peer is unreachable
+// from the sender.
+func (net *Network) route(from, to *peer.Peer) (*Transport, time.Duration, error) {
+	net.mtx.Lock()
+	defer net.mtx.Unlock()
+
+	dst, exists := net.transports[to.String()]
+	if !exists {
+		return nil, 0, fmt.Errorf("%w: %s", ErrUnreachable, to)
+	} else if net.partitions[from.String()] != net.partitions[to.String()] {
+		return nil, 0, fmt.Errorf("%w: %s partitioned", ErrUnreachable, to)
+	} else if net.dropRate > 0 && net.rand.Float64() < net.dropRate {
+		return nil, 0, ErrDropped
+	}
+	return dst, net.latency, nil
+}
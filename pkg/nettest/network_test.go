@@ -0,0 +1,122 @@
+package nettest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
+)
+
+func listen(t *testing.T, network *Network, port int) (*Transport, *peer.Peer) {
+	c := qt.New(t)
+
+	p, err := peer.New("localhost", port)
+	c.Assert(err, qt.IsNil)
+	tr := network.Transport()
+	err = tr.Listen(p, func(msg *message.Message) ([]byte, error) {
+		if msg.Type == message.DisconnectType {
+			return nil, transport.ErrForbidden
+		}
+		return msg.Data, nil
+	})
+	c.Assert(err, qt.IsNil)
+	return tr, p
+}
+
+func TestNetworkSend(t *testing.T) {
+	c := qt.New(t)
+
+	network := NewNetwork(1)
+	a, pa := listen(t, network, 5000)
+	_, pb := listen(t, network, 5001)
+	c.Assert(network.Transport().Listen(pa, nil), qt.IsNotNil)
+
+	c.Assert(a.Dial(context.Background(), pb), qt.IsNil)
+	msg := new(message.Message).SetFrom(pa).SetData([]byte("test"))
+	res, err := a.Send(context.Background(), pb, msg)
+	c.Assert(err, qt.IsNil)
+	c.Assert(res, qt.DeepEquals, []byte("test"))
+
+	msg = new(message.Message).SetType(message.DisconnectType).SetFrom(pa)
+	_, err = a.Send(context.Background(), pb, msg)
+	c.Assert(err, qt.ErrorIs, transport.ErrForbidden)
+
+	unknown, _ := peer.New("localhost", 5002)
+	c.Assert(a.Dial(context.Background(), unknown), qt.ErrorIs, ErrUnreachable)
+	_, err = a.Send(context.Background(), unknown, msg)
+	c.Assert(err, qt.ErrorIs, ErrUnreachable)
+
+	c.Assert(a.Close(), qt.IsNil)
+	c.Assert(a.Close(), qt.ErrorIs, transport.ErrClosed)
+	_, err = network.Transport().Send(context.Background(), pa, msg)
+	c.Assert(err, qt.ErrorIs, ErrUnreachable)
+}
+
+func TestNetworkListenSend(t *testing.T) {
+	c := qt.New(t)
+
+	// The messages sent while the destination starts listening are delivered
+	network := NewNetwork(1)
+	a, pa := listen(t, network, 5000)
+	pb, _ := peer.New("localhost", 5001)
+	msg := new(message.Message).SetFrom(pa).SetData([]byte("test"))
+	go listen(t, network, pb.Port)
+	for {
+		res, err := a.Send(context.Background(), pb, msg)
+		if err == nil {
+			c.Assert(res, qt.DeepEquals, []byte("test"))
+			break
+		}
+		c.Assert(err, qt.ErrorIs, ErrUnreachable)
+	}
+}
+
+func TestNetworkConditions(t *testing.T) {
+	c := qt.New(t)
+
+	network := NewNetwork(1)
+	a, pa := listen(t, network, 5000)
+	_, pb := listen(t, network, 5001)
+	msg := new(message.Message).SetFrom(pa).SetData([]byte("test"))
+
+	t.Run("latency", func(t *testing.T) {
+		network.SetLatency(50 * time.Millisecond)
+		defer network.SetLatency(0)
+
+		start := time.Now()
+		_, err := a.Send(context.Background(), pb, msg)
+		c.Assert(err, qt.IsNil)
+		c.Assert(time.Since(start) >= 50*time.Millisecond, qt.IsTrue)
+	})
+
+	t.Run("drop rate", func(t *testing.T) {
+		network.SetDropRate(1)
+		_, err := a.Send(context.Background(), pb, msg)
+		c.Assert(err, qt.ErrorIs, ErrDropped)
+
+		network.SetDropRate(0.5)
+		dropped := 0
+		for i := 0; i < 100; i++ {
+			if _, err := a.Send(context.Background(), pb, msg); err != nil {
+				dropped++
+			}
+		}
+		c.Assert(dropped > 0 && dropped < 100, qt.IsTrue)
+		network.SetDropRate(0)
+	})
+
+	t.Run("partitions", func(t *testing.T) {
+		network.Partition([]*peer.Peer{pa}, []*peer.Peer{pb})
+		_, err := a.Send(context.Background(), pb, msg)
+		c.Assert(err, qt.ErrorIs, ErrUnreachable)
+		c.Assert(a.Dial(context.Background(), pb), qt.ErrorIs, ErrUnreachable)
+
+		network.Heal()
+		_, err = a.Send(context.Background(), pb, msg)
+		c.Assert(err, qt.IsNil)
+	})
+}
@@ -0,0 +1,158 @@
+package nettest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
+)
+
+// delivery struct contains a message sent through the virtual network and the
+// channel where the destination transport writes the handler response.
+type delivery struct {
+	msg   *message.Message
+	reply chan response
+}
+
+// response struct contains the result of handling a delivered message.
+type response struct {
+	data []byte
+	err  error
+}
+
+// Transport struct implements the transport.Transport interface over a
+// virtual Network. It receives the incoming messages through a channel and
+// handles each one in its own goroutine, as a real server does.
+type Transport struct {
+	network *Network
+	self    *peer.Peer
+	inbox   chan *delivery
+	done    chan struct{}
+	mtx     *sync.Mutex
+}
+
+// Listen function attaches the current transport to its network on the
+// provided peer address and starts to pass every incoming message to the
+// handler provided.
+func (t *Transport) Listen(self *peer.Peer, handler transport.Handler) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.self != nil {
+		return fmt.Errorf("transport already listening")
+	}
+
+	// Create the channels before registering the transport, so the senders
+	// that find it on the network can use them.
+	inbox, done := make(chan *delivery), make(chan struct{})
+	if err := t.network.register(self, t); err != nil {
+		return err
+	}
+	t.self = self
+	t.inbox, t.done = inbox, done
+
+	go func(inbox chan *delivery, done chan struct{}) {
+		for {
+			select {
+			case d := <-inbox:
+				go func() {
+					data, err := handler(d.msg)
+					d.reply <- response{data, err}
+				}()
+			case <-done:
+				return
+			}
+		}
+	}(t.inbox, t.done)
+	return nil
+}
+
+// Dial function checks that the provided peer is listening on the network and
+// reachable from the current transport. It does not wait, so the provided
+// context is not used.
+func (t *Transport) Dial(ctx context.Context, to *peer.Peer) error {
+	_, _, err := t.network.route(t.sender(to), to)
+	return err
+}
+
+// Send function delivers a copy of the provided message to the transport
+// listening on the destination peer, simulating the network conditions, and
+// waits for its response, until the provided context is done.
+func (t *Transport) Send(ctx context.Context, to *peer.Peer, msg *message.Message) ([]byte, error) {
+	// Encode and decode the message to avoid sharing memory between the
+	// sender and the receiver, as a real network does.
+	encMsg := msg.JSON()
+	if encMsg == nil {
+		return nil, fmt.Errorf("error encoding message to JSON")
+	}
+	copyMsg := new(message.Message).SetJSON(encMsg)
+
+	dst, latency, err := t.network.route(t.sender(msg.From), to)
+	if err != nil {
+		return nil, err
+	}
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: sending to %s", ctx.Err(), to)
+		}
+	}
+
+	d := &delivery{msg: copyMsg, reply: make(chan response, 1)}
+	inbox, done := dst.channels()
+	select {
+	case inbox <- d:
+	case <-done:
+		return nil, fmt.Errorf("%w: %s", ErrUnreachable, to)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: sending to %s", ctx.Err(), to)
+	}
+
+	select {
+	case res := <-d.reply:
+		return res.data, res.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: sending to %s", ctx.Err(), to)
+	}
+}
+
+// Close function detaches the current transport from its network and stops
+// handling incoming messages.
+func (t *Transport) Close() error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.self == nil {
+		return transport.ErrClosed
+	}
+
+	t.network.unregister(t.self)
+	close(t.done)
+	t.self = nil
+	return nil
+}
+
+// channels function returns safely the channels of the current transport to
+// deliver it the incoming messages and to know when it stops listening.
+func (t *Transport) channels() (chan *delivery, chan struct{}) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.inbox, t.done
+}
+
+// sender function returns the peer that the current transport is listening
+// on, or the fallback peer provided if it is not listening yet, to route the
+// messages sent from the current transport.
+func (t *Transport) sender(fallback *peer.Peer) *peer.Peer {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.self != nil {
+		return t.self
+	}
+	return fallback
+}
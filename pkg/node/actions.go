@@ -1,9 +1,9 @@
 package node
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
 
 	"github.com/lucasmenendez/gop2p/pkg/message"
 	"github.com/lucasmenendez/gop2p/pkg/peer"
@@ -13,33 +13,42 @@ import (
 // that is already into that network. The function request a connection to that
 // peer and it response with the current network members. To complete the
 // joining, the current node send the same request to ever member received to
-// populate its information.
-func (n *Node) connect(entryPoint *peer.Peer) *NodeErr {
-	// Create the request using a connection message.
+// populate its information. If the node has identity, the connection message
+// includes the proof of possession of its private key. If the provided context
+// is done, or the connection to any member fails, it stops connecting to the
+// rest of members and rolls back the connection (see Node.abort), so the node
+// is not connected.
+func (n *Node) connect(ctx context.Context, entryPoint *peer.Peer) (nodeErr *NodeErr) {
+	// Create a connection message and dial the entry point through the node
+	// transport.
 	msg := new(message.Message).SetType(message.ConnectType).SetFrom(n.Self)
-	req, err := composeRequest(msg, entryPoint)
-	if err != nil {
-		return ParseErr("error encoding message to request", err)
+	if n.key != nil {
+		// Include the proof of possession of the node private key.
+		msg.Data = n.connectProof()
 	}
-
-	// Try to join into the network through the provided peer
-	res, err := n.client.Do(req)
-	if err != nil {
+	n.prepare(msg)
+	if err := n.transport.Dial(ctx, entryPoint); err != nil {
 		return ConnErr("error trying to connect to a peer", err)
 	}
 
-	if code := res.StatusCode; code != http.StatusOK {
-		err := fmt.Errorf("%d http status received from %s", code, entryPoint)
-		return ConnErr("error making the request to a peer", err)
+	// Keep the peers that could register the current node as a member, and
+	// the ones that it registers, to roll back the connection if it fails.
+	contacted, joined := []*peer.Peer{}, []*peer.Peer{}
+	defer func() {
+		if nodeErr != nil {
+			n.abort(contacted, joined)
+		}
+	}()
+	if !n.Members.Contains(entryPoint) {
+		contacted = append(contacted, entryPoint)
 	}
 
-	// Reading the list of current members of the network from the peer
-	// response.
-	body, err := io.ReadAll(res.Body)
+	// Try to join into the network through the provided peer, reading the list
+	// of current members of the network from the peer response.
+	body, err := n.transport.Send(ctx, entryPoint, msg)
 	if err != nil {
-		return ParseErr("error reading peer response body", err)
+		return ConnErr("error trying to connect to a peer", err)
 	}
-	res.Body.Close()
 
 	// Parsing the received list
 	receivedMembers := peer.NewMembers()
@@ -52,27 +61,64 @@ func (n *Node) connect(entryPoint *peer.Peer) *NodeErr {
 	for _, member := range receivedMembers.Peers() {
 		// If a received peer is not the same that contains the current node try
 		// to connect directly.
-		if !n.Self.Equal(member) {
-			if req, err := composeRequest(msg, member); err != nil {
-				return ParseErr("error decoding request to message", err)
-			} else if _, err := n.client.Do(req); err != nil {
+		if err := ctx.Err(); err != nil {
+			return ConnErr("error trying to connect to a peer", err)
+		} else if !n.Self.Equal(member) {
+			known := n.Members.Contains(member)
+			if err := n.transport.Dial(ctx, member); err != nil {
+				return ConnErr("error trying to connect to a peer", err)
+			} else if !known {
+				contacted = append(contacted, member)
+			}
+			if _, err := n.transport.Send(ctx, member, msg); err != nil {
 				return ConnErr("error trying to perform the request", err)
 			}
-			n.Members.Append(member)
+			if !known {
+				joined = append(joined, member)
+				n.join(member, "connected")
+			}
 		}
 	}
 
 	// Set node status as connected.
 	n.setConnected(true)
 	// Append the entrypoint to the current members.
-	n.Members.Append(entryPoint)
+	n.join(entryPoint, "connected")
+	// Exchange the topics subscribed with the members.
+	n.announce(n.Members.Peers())
 	return nil
 }
 
+// abort function rolls back a connection that fails or is cancelled before
+// completing: it removes the provided members joined during the connection
+// and warns about the disconnection to the provided peers contacted, that
+// could have registered the current node as a member. The warnings are sent
+// in background, with the node context, because the context of the connection
+// can be already done.
+func (n *Node) abort(contacted, joined []*peer.Peer) {
+	for _, member := range joined {
+		n.leave(member, "connection aborted")
+	}
+	if len(contacted) == 0 {
+		return
+	}
+
+	msg := new(message.Message).SetType(message.DisconnectType).SetFrom(n.Self)
+	n.prepare(msg)
+	n.waiter.Add(1)
+	go func() {
+		defer n.waiter.Done()
+		for _, p := range contacted {
+			n.sendWithin(n.ctx, p, msg, n.peerTimeout)
+		}
+	}()
+}
+
 // disconnect function perform a graceful disconnection, warning to other
 // network members about the disconnection and deleting registered peers from
-// current member list.
-func (n *Node) disconnect() *NodeErr {
+// current member list. If the provided context is done before every member is
+// warned, the node keeps connected.
+func (n *Node) disconnect(ctx context.Context) *NodeErr {
 	// Send an error to Node.Error channel if the node is not connected
 	if !n.IsConnected() {
 		return ConnErr("node not connected", nil)
@@ -80,47 +126,58 @@ func (n *Node) disconnect() *NodeErr {
 
 	// Warn to other network peers about the disconnection
 	msg := new(message.Message).SetType(message.DisconnectType).SetFrom(n.Self)
-	if err := n.broadcast(msg); err != nil {
+	if err := n.broadcast(ctx, msg); err != nil {
 		return err
 	}
 
-	// Clean current member list
-	n.Members = peer.NewMembers()
+	// Clean current member list, deleting every member to keep the list used
+	// by the background tasks of the node.
+	for _, member := range n.Members.Peers() {
+		n.leave(member, "node disconnected")
+	}
 	n.setConnected(false)
 	return nil
 }
 
 // broadcast function sends the message provided to every peer registered on the
-// node network. It iterates over current network peers performing a
-// http.Request from the message provided.
-func (n *Node) broadcast(msg *message.Message) *NodeErr {
+// node network. It sends the message to the current network peers
+// concurrently through the node transport, and returns an error that collects
+// the errors of every peer that does not receive it. If the message has a TTL
+// or the node has gossip enabled, the broadcast messages are disseminated
+// epidemically instead. Once the provided context is done, the message is not
+// sent to the rest of members.
+func (n *Node) broadcast(ctx context.Context, msg *message.Message) *NodeErr {
 	// Send an error to Node.Error channel if the node is not connected
 	if !n.IsConnected() {
 		return ConnErr("node not connected", nil)
+	} else if msg.Type == message.BroadcastType && (msg.TTL > 0 || n.gossip != nil) {
+		return n.disseminate(ctx, msg)
 	}
 
-	// Iterate over each member encoding as a request and performing it with
-	// the provided Message.
+	// Iterate over each member sending it the provided Message, stamped and
+	// signed if the node has identity.
+	n.prepare(msg)
 	encMsg := msg.JSON()
 	if encMsg == nil {
 		return ParseErr("error encoding message to JSON", nil)
 	}
-	for _, member := range n.Members.Peers() {
-		req, err := composeRequest(msg, member)
-		if err != nil {
-			return ParseErr("error decoding request to message", err)
-		}
-
-		if _, err := n.client.Do(req); err != nil {
-			return ConnErr("error trying to perform the request", err)
+	errs := []error{}
+	for _, delivery := range n.fanout(ctx, msg, n.Members.Peers(), &RetryPolicy{Attempts: 1}) {
+		if delivery.Status != Delivered {
+			errs = append(errs, fmt.Errorf("%s: %w", delivery.Peer, delivery.Err))
 		}
 	}
+	if len(errs) > 0 {
+		return ConnErr("error trying to perform the request", errors.Join(errs...))
+	}
 	return nil
 }
 
 // send function sends the message provided to a single peer registered from the
-// current node network.
-func (n *Node) send(msg *message.Message) *NodeErr {
+// current node network. If the node has encryption enabled, the message data
+// is encrypted for every intended peer. Once the provided context is done, the
+// message is not sent to the rest of peers.
+func (n *Node) send(ctx context.Context, msg *message.Message) *NodeErr {
 	if !n.IsConnected() {
 		// Return an error if the current node is not connected
 		return ConnErr("node not connected", nil)
@@ -129,23 +186,24 @@ func (n *Node) send(msg *message.Message) *NodeErr {
 		return InternalErr("no intended peer defined at provided message", nil)
 	}
 
+	n.prepare(msg)
 	encMsg := msg.JSON()
 	if encMsg == nil {
 		return ParseErr("error encoding message to JSON", nil)
 	}
 	for _, to := range msg.To {
-		if !n.Members.Contains(to) {
-			// Return an error if the current network does not contains the
-			// Message.To peer provided
-			return ConnErr("target peer is not into the network", nil)
+		if err := ctx.Err(); err != nil {
+			return ConnErr("error trying to perform the request", err)
 		}
-
-		// Encode message as a request and send it
-		req, err := composeRequest(msg, to)
+		// Get the message to send to the intended peer, encrypted if the node
+		// has direct message encryption enabled.
+		toMsg, err := n.outgoing(msg, to)
 		if err != nil {
-			return ParseErr("error decoding request to message", err)
+			return err
 		}
-		if _, err := n.client.Do(req); err != nil {
+
+		// Send the message to the intended peer
+		if _, err := n.transport.Send(ctx, to, toMsg); err != nil {
 			return ConnErr("error trying to perform the request", err)
 		}
 	}
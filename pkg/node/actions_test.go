@@ -1,6 +1,7 @@
 package node
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"testing"
@@ -8,6 +9,7 @@ import (
 
 	qt "github.com/frankban/quicktest"
 	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/nettest"
 	"github.com/lucasmenendez/gop2p/pkg/peer"
 )
 
@@ -28,7 +30,7 @@ func Test_connect(t *testing.T) {
 
 		entryPoint, _ := peer.Me(port, false)
 		client := New(me)
-		client.connect(entryPoint)
+		client.connect(context.Background(), entryPoint)
 		c.Assert(client.Members.Contains(entryPoint), qt.IsTrue)
 	})
 
@@ -42,7 +44,7 @@ func Test_connect(t *testing.T) {
 			c.Assert(err, qt.ErrorAs, new(*NodeErr))
 			c.Assert(err.ErrCode, qt.Equals, CONNECTION_ERR)
 		}()
-		client.connect(entryPoint)
+		client.connect(context.Background(), entryPoint)
 	})
 
 	t.Run("connection fails", func(t *testing.T) {
@@ -60,7 +62,7 @@ func Test_connect(t *testing.T) {
 			c.Assert(err, qt.ErrorAs, new(*NodeErr))
 			c.Assert(err.ErrCode, qt.Equals, CONNECTION_ERR)
 		}()
-		client.connect(entryPoint)
+		client.connect(context.Background(), entryPoint)
 	})
 }
 
@@ -88,14 +90,14 @@ func Test_disconnect(t *testing.T) {
 			c.Assert(err, qt.ErrorAs, new(*NodeErr))
 			c.Assert(err.ErrCode, qt.Equals, CONNECTION_ERR)
 		}()
-		client.disconnect()
+		client.disconnect(context.Background())
 	})
 
 	t.Run("success disconnection", func(t *testing.T) {
 		client := New(me)
 		entryPoint, _ := peer.Me(port, false)
-		client.connect(entryPoint)
-		client.disconnect()
+		client.connect(context.Background(), entryPoint)
+		client.disconnect(context.Background())
 		c.Assert(client.Members.Contains(entryPoint), qt.IsFalse)
 	})
 }
@@ -126,16 +128,16 @@ func Test_broadcast(t *testing.T) {
 
 	entryPoint, _ := peer.Me(port, false)
 	client := New(me)
-	client.connect(entryPoint)
+	client.connect(context.Background(), entryPoint)
 
 	t.Run("success broadcast", func(t *testing.T) {
 		time.Sleep(time.Second)
 		msg := new(message.Message).SetFrom(me).SetData(expMsg)
-		client.broadcast(msg)
+		client.broadcast(context.Background(), msg)
 	})
 
 	t.Run("broadcast fails", func(t *testing.T) {
-		client.disconnect()
+		client.disconnect(context.Background())
 		go func() {
 			err := <-client.Error
 			c.Assert(err, qt.IsNotNil)
@@ -144,7 +146,7 @@ func Test_broadcast(t *testing.T) {
 		}()
 
 		msg := new(message.Message).SetFrom(me).SetData(expMsg)
-		client.broadcast(msg)
+		client.broadcast(context.Background(), msg)
 	})
 }
 
@@ -170,16 +172,16 @@ func Test_send(t *testing.T) {
 	entryPoint, _ := peer.Me(port, false)
 	me, _ := peer.Me(getRandomPort(), false)
 	client := New(me)
-	client.connect(entryPoint)
+	client.connect(context.Background(), entryPoint)
 
 	t.Run("success send", func(t *testing.T) {
 		msg := new(message.Message).SetFrom(me).SetData(directData).SetTo(entryPoint)
-		err := client.send(msg)
+		err := client.send(context.Background(), msg)
 		c.Assert(err, qt.DeepEquals, (*NodeErr)(nil))
 	})
 
 	t.Run("broadcast fails", func(t *testing.T) {
-		client.disconnect()
+		client.disconnect(context.Background())
 		go func() {
 			err := <-client.Error
 			c.Assert(err, qt.IsNotNil)
@@ -188,6 +190,108 @@ func Test_send(t *testing.T) {
 		}()
 
 		msg := new(message.Message).SetFrom(me).SetType(message.DirectType)
-		client.send(msg)
+		client.send(context.Background(), msg)
 	})
 }
+
+func Test_actionsOverVirtualNetwork(t *testing.T) {
+	c := qt.New(t)
+
+	network := nettest.NewNetwork(1)
+	entryPoint := initMemoryNode(t, network, 5000)
+	first := initMemoryNode(t, network, 5001)
+	second := initMemoryNode(t, network, 5002)
+
+	// Connect both nodes to the network through the entry point
+	c.Assert(first.connect(context.Background(), entryPoint.Self), qt.DeepEquals, (*NodeErr)(nil))
+	c.Assert(second.connect(context.Background(), entryPoint.Self), qt.DeepEquals, (*NodeErr)(nil))
+	c.Assert(entryPoint.Members.Len(), qt.Equals, 2)
+	c.Assert(first.Members.Contains(second.Self), qt.IsTrue)
+	c.Assert(second.Members.Contains(first.Self), qt.IsTrue)
+
+	// Broadcast a message from the second node
+	data := []byte("hello")
+	msg := new(message.Message).SetFrom(second.Self).SetData(data)
+	go func() {
+		c.Assert(second.broadcast(context.Background(), msg), qt.DeepEquals, (*NodeErr)(nil))
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case received := <-entryPoint.Inbox:
+			c.Assert(received.Data, qt.DeepEquals, data)
+		case received := <-first.Inbox:
+			c.Assert(received.Data, qt.DeepEquals, data)
+		}
+	}
+
+	// Send a direct message from the first node to the second one
+	msg = new(message.Message).SetFrom(first.Self).SetData(data).SetTo(second.Self)
+	go func() {
+		c.Assert(first.send(context.Background(), msg), qt.DeepEquals, (*NodeErr)(nil))
+	}()
+	received := <-second.Inbox
+	c.Assert(received.Type, qt.Equals, message.DirectType)
+	c.Assert(received.From.Equal(first.Self), qt.IsTrue)
+
+	// Broadcast fails if the network is partitioned
+	network.Partition([]*peer.Peer{first.Self})
+	msg = new(message.Message).SetFrom(first.Self).SetData(data)
+	err := first.broadcast(context.Background(), msg)
+	c.Assert(err, qt.IsNotNil)
+	c.Assert(err.ErrCode, qt.Equals, CONNECTION_ERR)
+	network.Heal()
+
+	// Disconnect the second node from the network
+	c.Assert(second.disconnect(context.Background()), qt.DeepEquals, (*NodeErr)(nil))
+	c.Assert(entryPoint.Members.Contains(second.Self), qt.IsFalse)
+	c.Assert(first.Members.Contains(second.Self), qt.IsFalse)
+	c.Assert(second.IsConnected(), qt.IsFalse)
+}
+
+func Test_broadcastFanout(t *testing.T) {
+	c := qt.New(t)
+
+	network := nettest.NewNetwork(1)
+	p, _ := peer.New("localhost", 5000)
+	sender := New(p, WithTransport(network.Transport()), WithFanout(4, 100*time.Millisecond))
+	sender.Start()
+	members := []*Node{}
+	for port := 5001; port <= 5004; port++ {
+		member := initMemoryNode(t, network, port)
+		c.Assert(member.connect(context.Background(), sender.Self), qt.DeepEquals, (*NodeErr)(nil))
+		go func() {
+			for range member.Inbox {
+			}
+		}()
+		members = append(members, member)
+	}
+
+	// The members receive the message concurrently
+	network.SetLatency(50 * time.Millisecond)
+	start := time.Now()
+	msg := new(message.Message).SetFrom(sender.Self).SetData([]byte("hello"))
+	c.Assert(sender.broadcast(context.Background(), msg), qt.DeepEquals, (*NodeErr)(nil))
+	c.Assert(time.Since(start) < 150*time.Millisecond, qt.IsTrue)
+
+	// Slow or unreachable peers do not prevent the delivery to the rest, and
+	// every error is reported
+	network.SetLatency(0)
+	network.Partition([]*peer.Peer{members[0].Self, members[1].Self})
+	msg = new(message.Message).SetFrom(sender.Self).SetData([]byte("hello"))
+	err := sender.broadcast(context.Background(), msg)
+	c.Assert(err, qt.IsNotNil)
+	c.Assert(err.ErrCode, qt.Equals, CONNECTION_ERR)
+	c.Assert(err.Error(), qt.Contains, members[0].Self.String())
+	c.Assert(err.Error(), qt.Contains, members[1].Self.String())
+	c.Assert(err.Error(), qt.Not(qt.Contains), members[2].Self.String())
+	network.Heal()
+
+	// Peers that do not respond in time are reported as timed out
+	network.SetLatency(300 * time.Millisecond)
+	start = time.Now()
+	msg = new(message.Message).SetFrom(sender.Self).SetData([]byte("hello"))
+	err = sender.broadcast(context.Background(), msg)
+	c.Assert(err, qt.IsNotNil)
+	c.Assert(err.Error(), qt.Contains, errDeliveryTimeout.Error())
+	c.Assert(time.Since(start) < 300*time.Millisecond, qt.IsTrue)
+}
@@ -0,0 +1,410 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
+)
+
+const (
+	// blobHave identifies the blob queries that announce that the sender has
+	// a blob.
+	blobHave = "have"
+	// blobManifest identifies the blob queries that request the manifest of a
+	// blob.
+	blobManifest = "manifest"
+	// blobChunk identifies the blob queries that request a chunk of a blob.
+	blobChunk = "chunk"
+	// defaultMaxBlobSize contains the default maximum size in bytes of the
+	// blobs that the node gets from other peers.
+	defaultMaxBlobSize = 64 << 20
+)
+
+var (
+	// ErrBlobNotFound is returned when no network member has the blob
+	// requested.
+	ErrBlobNotFound = fmt.Errorf("blob not found")
+	// ErrCorruptedBlob is returned when the content of a blob received does
+	// not match its hash.
+	ErrCorruptedBlob = fmt.Errorf("corrupted blob")
+)
+
+// blobQuery struct contains the operation requested by a BlobType message, the
+// hash of the blob and, for chunk requests, the index of the chunk.
+type blobQuery struct {
+	Op    string `json:"op"`
+	Hash  []byte `json:"hash"`
+	Chunk int    `json:"chunk,omitempty"`
+}
+
+// manifest struct describes how a blob is split into chunks: its size, the
+// size of every chunk and the hash of each one.
+type manifest struct {
+	Size      int      `json:"size"`
+	ChunkSize int      `json:"chunk_size"`
+	Chunks    [][]byte `json:"chunks"`
+}
+
+// valid function returns if the manifest is consistent, having the number of
+// chunks required by its size and chunk size, and its size does not exceed the
+// provided maximum size.
+func (m *manifest) valid(maxSize int) bool {
+	if m.Size < 0 || m.Size > maxSize || m.ChunkSize <= 0 {
+		return false
+	} else if m.Size == 0 {
+		return len(m.Chunks) == 0
+	}
+	return len(m.Chunks) == (m.Size-1)/m.ChunkSize+1
+}
+
+// chunk function returns the bounds of the chunk with the provided index.
+func (m *manifest) chunk(i int) (int, int) {
+	start, end := i*m.ChunkSize, (i+1)*m.ChunkSize
+	if end > m.Size {
+		end = m.Size
+	}
+	return start, end
+}
+
+// blob struct contains the content of a blob stored by the node and its
+// manifest.
+type blob struct {
+	data     []byte
+	manifest *manifest
+}
+
+// blobs struct contains the blobs stored by the node and the network members
+// that announced each blob, by the hex-encoded hash of their content.
+type blobs struct {
+	local     map[string]*blob
+	providers map[string][]string
+	mtx       *sync.RWMutex
+}
+
+// newBlobs function creates an empty blobs.
+func newBlobs() *blobs {
+	return &blobs{
+		local:     map[string]*blob{},
+		providers: map[string][]string{},
+		mtx:       &sync.RWMutex{},
+	}
+}
+
+// get function returns the blob stored with the provided hash, or nil if it is
+// not stored.
+func (b *blobs) get(hash []byte) *blob {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	return b.local[hex.EncodeToString(hash)]
+}
+
+// provide function registers the provided peer as a provider of the blob with
+// the provided hash.
+func (b *blobs) provide(hash []byte, p *peer.Peer) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	key := hex.EncodeToString(hash)
+	for _, provider := range b.providers[key] {
+		if provider == p.String() {
+			return
+		}
+	}
+	b.providers[key] = append(b.providers[key], p.String())
+}
+
+// provided function returns if the provided peer announced the blob with the
+// provided hash.
+func (b *blobs) provided(hash []byte, p *peer.Peer) bool {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	for _, provider := range b.providers[hex.EncodeToString(hash)] {
+		if provider == p.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// Put function stores the provided data as a blob identified by the SHA-256
+// hash of its content, that it returns, and announces it to the current
+// network members, so they can get it with Node.Get. The blob is split into
+// chunks of the node chunk size, that the members can get from different
+// peers.
+func (n *Node) Put(data []byte) []byte {
+	hash := sha256.Sum256(data)
+	m := &manifest{Size: len(data), ChunkSize: n.chunkSize}
+	m.Chunks = make([][]byte, (m.Size+m.ChunkSize-1)/m.ChunkSize)
+	for i := range m.Chunks {
+		start, end := m.chunk(i)
+		chunk := sha256.Sum256(data[start:end])
+		m.Chunks[i] = chunk[:]
+	}
+	n.store(hash[:], &blob{data: bytes.Clone(data), manifest: m})
+	return hash[:]
+}
+
+// store function stores the provided blob with the provided hash and, if the
+// node is connected, announces it to the current network members in
+// background.
+func (n *Node) store(hash []byte, b *blob) {
+	n.blobs.mtx.Lock()
+	n.blobs.local[hex.EncodeToString(hash)] = b
+	n.blobs.mtx.Unlock()
+
+	if !n.IsConnected() {
+		return
+	}
+	data, _ := json.Marshal(&blobQuery{Op: blobHave, Hash: hash})
+	msg := new(message.Message).SetType(message.BlobType).SetFrom(n.Self)
+	msg.Data = data
+	n.prepare(msg)
+	n.waiter.Add(1)
+	go func() {
+		defer n.waiter.Done()
+		n.fanout(n.ctx, msg, n.Members.Peers(), &RetryPolicy{Attempts: 1})
+	}()
+}
+
+// Get function returns the blob with the provided hash, from the blobs stored
+// by the node or from the network members that have it. The members that
+// announced the blob are asked first, and the rest of them only if none of
+// them has it. The chunks of the blob are requested in parallel to the members
+// that have it, verifying the hash of each chunk and of the whole content.
+// The blob received is stored and announced by the node. It returns an error
+// wrapping ErrBlobNotFound if no member has the blob, ErrCorruptedBlob if the
+// content received does not match the hash, or the context error if it is
+// done before the blob is received.
+func (n *Node) Get(ctx context.Context, hash []byte) ([]byte, error) {
+	if b := n.blobs.get(hash); b != nil {
+		return bytes.Clone(b.data), nil
+	} else if !n.IsConnected() {
+		return nil, ConnErr("node not connected", nil)
+	}
+
+	announced := n.Members.Select(func(p *peer.Peer) bool {
+		return n.blobs.provided(hash, p)
+	})
+	groups := n.manifests(ctx, hash, announced)
+	if len(groups) == 0 {
+		others := n.Members.Select(func(p *peer.Peer) bool {
+			return !n.blobs.provided(hash, p)
+		})
+		groups = n.manifests(ctx, hash, others)
+	}
+	if len(groups) == 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, ConnErr("error getting the blob", err)
+		}
+		return nil, ConnErr("error getting the blob", ErrBlobNotFound)
+	}
+
+	// Try the manifests in order, falling back to the next one if the blob
+	// can not be received from the peers that respond with it.
+	errs := []error{}
+	for _, group := range groups {
+		data, err := n.fetch(ctx, hash, group.manifest, group.providers)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ConnErr("error getting the blob", ctx.Err())
+			}
+			errs = append(errs, err)
+			continue
+		}
+		if sum := sha256.Sum256(data); !bytes.Equal(sum[:], hash) {
+			errs = append(errs, ErrCorruptedBlob)
+			continue
+		}
+		n.store(hash, &blob{data: data, manifest: group.manifest})
+		return bytes.Clone(data), nil
+	}
+	return nil, ConnErr("error getting the blob", errors.Join(errs...))
+}
+
+// manifestGroup struct contains a manifest of a blob and the peers that
+// respond with it.
+type manifestGroup struct {
+	manifest  *manifest
+	providers []*peer.Peer
+}
+
+// manifests function requests the manifest of the blob with the provided hash
+// to the provided peers concurrently. It returns the valid manifests received
+// grouped with the peers that respond with each one, sorted by the number of
+// peers, so the most common manifest comes first. The manifests of blobs
+// larger than the node maximum blob size are discarded.
+func (n *Node) manifests(ctx context.Context, hash []byte, peers []*peer.Peer) []*manifestGroup {
+	type result struct {
+		peer *peer.Peer
+		res  []byte
+	}
+	results := make(chan result, len(peers))
+	for _, p := range peers {
+		go func(p *peer.Peer) {
+			res, err := n.queryBlob(ctx, p, &blobQuery{Op: blobManifest, Hash: hash})
+			if err != nil {
+				res = nil
+			}
+			results <- result{p, res}
+		}(p)
+	}
+
+	groups := []*manifestGroup{}
+	encoded := map[string]*manifestGroup{}
+	for range peers {
+		r := <-results
+		if r.res == nil {
+			continue
+		}
+		group, exists := encoded[string(r.res)]
+		if !exists {
+			candidate := &manifest{}
+			if err := json.Unmarshal(r.res, candidate); err != nil || !candidate.valid(n.maxBlobSize) {
+				continue
+			}
+			group = &manifestGroup{manifest: candidate}
+			encoded[string(r.res)] = group
+			groups = append(groups, group)
+		}
+		group.providers = append(group.providers, r.peer)
+		n.blobs.provide(hash, r.peer)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].providers) > len(groups[j].providers)
+	})
+	return groups
+}
+
+// fetch function requests the chunks of the blob with the provided hash and
+// manifest to the provided peers in parallel, spreading them between the
+// peers, and returns the content of the blob. If a chunk can not be received
+// from a peer or does not match its hash, it is requested to the next one. It
+// returns an error if any chunk can not be received from any peer.
+func (n *Node) fetch(ctx context.Context, hash []byte, m *manifest, providers []*peer.Peer) ([]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	data := make([]byte, m.Size)
+	chunks := make(chan int, len(m.Chunks))
+	for i := range m.Chunks {
+		chunks <- i
+	}
+	close(chunks)
+
+	workers := n.workers
+	if workers > len(m.Chunks) {
+		workers = len(m.Chunks)
+	}
+	errs := make(chan error, workers)
+	wg := &sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := range chunks {
+				if err := n.fetchChunk(ctx, hash, m, i, providers, w, data); err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// fetchChunk function requests the chunk with the provided index to the
+// provided peers, starting by the one at the provided offset, until one of
+// them responds with the content that matches the chunk hash, that is copied
+// into the provided data.
+func (n *Node) fetchChunk(ctx context.Context, hash []byte, m *manifest, i int, providers []*peer.Peer, offset int, data []byte) error {
+	start, end := m.chunk(i)
+	errs := []error{}
+	for attempt := 0; attempt < len(providers); attempt++ {
+		p := providers[(offset+i+attempt)%len(providers)]
+		res, err := n.queryBlob(ctx, p, &blobQuery{Op: blobChunk, Hash: hash, Chunk: i})
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", p, err))
+			continue
+		}
+		if sum := sha256.Sum256(res); len(res) != end-start || !bytes.Equal(sum[:], m.Chunks[i]) {
+			errs = append(errs, fmt.Errorf("%s: %w: chunk %d", p, ErrCorruptedBlob, i))
+			continue
+		}
+		copy(data[start:end], res)
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// queryBlob function sends the provided blob query to the provided peer and
+// returns its response, waiting up to the node per-peer timeout or until the
+// provided context is done.
+func (n *Node) queryBlob(ctx context.Context, to *peer.Peer, query *blobQuery) ([]byte, error) {
+	data, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+	msg := new(message.Message).SetType(message.BlobType).SetFrom(n.Self)
+	msg.Data = data
+	n.prepare(msg)
+	if n.peerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.peerTimeout)
+		defer cancel()
+	}
+	return n.sendContext(ctx, to, msg)
+}
+
+// handleBlob function handles the blob queries received: it registers the
+// sender as a provider of the blobs announced, and responds with the manifest
+// or a chunk of the blobs requested. It returns a transport.ErrNotAllowed
+// error if the node does not have the blob requested.
+func (n *Node) handleBlob(msg *message.Message) ([]byte, error) {
+	if err := n.verifySender(msg); err != nil {
+		return nil, err
+	}
+	n.applyUpdates(msg.Updates)
+
+	query := &blobQuery{}
+	if err := json.Unmarshal(msg.Data, query); err != nil {
+		return nil, fmt.Errorf("%w: %v", transport.ErrBadMessage, err)
+	} else if query.Op == blobHave {
+		n.blobs.provide(query.Hash, msg.From)
+		return nil, nil
+	}
+
+	b := n.blobs.get(query.Hash)
+	if b == nil {
+		return nil, fmt.Errorf("%w: %v", transport.ErrNotAllowed, ErrBlobNotFound)
+	}
+	switch query.Op {
+	case blobManifest:
+		return json.Marshal(b.manifest)
+	case blobChunk:
+		if query.Chunk < 0 || query.Chunk >= len(b.manifest.Chunks) {
+			return nil, fmt.Errorf("%w: unknown chunk", transport.ErrBadMessage)
+		}
+		start, end := b.manifest.chunk(query.Chunk)
+		return b.data[start:end], nil
+	default:
+		return nil, fmt.Errorf("%w: unknown blob operation", transport.ErrBadMessage)
+	}
+}
@@ -0,0 +1,123 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/lucasmenendez/gop2p/pkg/nettest"
+)
+
+func Test_manifest(t *testing.T) {
+	c := qt.New(t)
+
+	m := &manifest{Size: 10, ChunkSize: 4, Chunks: make([][]byte, 3)}
+	c.Assert(m.valid(defaultMaxBlobSize), qt.IsTrue)
+	start, end := m.chunk(0)
+	c.Assert([]int{start, end}, qt.DeepEquals, []int{0, 4})
+	start, end = m.chunk(2)
+	c.Assert([]int{start, end}, qt.DeepEquals, []int{8, 10})
+
+	c.Assert((&manifest{Size: 10, ChunkSize: 4, Chunks: make([][]byte, 2)}).valid(defaultMaxBlobSize), qt.IsFalse)
+	c.Assert((&manifest{Size: 10, ChunkSize: 0}).valid(defaultMaxBlobSize), qt.IsFalse)
+	c.Assert((&manifest{Size: 0, ChunkSize: 4}).valid(defaultMaxBlobSize), qt.IsTrue)
+
+	// Manifests larger than the maximum size are not valid
+	c.Assert(m.valid(9), qt.IsFalse)
+	huge := &manifest{Size: 1 << 50, ChunkSize: 1 << 50, Chunks: make([][]byte, 1)}
+	c.Assert(huge.valid(defaultMaxBlobSize), qt.IsFalse)
+	c.Assert((&manifest{Size: 10, ChunkSize: 1<<62 + 1, Chunks: make([][]byte, 1)}).valid(defaultMaxBlobSize), qt.IsTrue)
+}
+
+func TestNodeBlobs(t *testing.T) {
+	c := qt.New(t)
+
+	network := nettest.NewNetwork(1)
+	first := initMemoryNode(t, network, 5000)
+	second := initMemoryNode(t, network, 5001)
+	third := initMemoryNode(t, network, 5002)
+	WithChunkSize(4)(first)
+	ctx := context.Background()
+	content := []byte("content addressed blob")
+
+	// Blobs are available locally without being connected
+	hash := first.Put(content)
+	expected := sha256.Sum256(content)
+	c.Assert(hash, qt.DeepEquals, expected[:])
+	data, err := first.Get(ctx, hash)
+	c.Assert(err, qt.IsNil)
+	c.Assert(data, qt.DeepEquals, content)
+	_, err = second.Get(ctx, hash)
+	c.Assert(err, qt.ErrorAs, new(*NodeErr))
+	c.Assert(err.(*NodeErr).ErrCode, qt.Equals, CONNECTION_ERR)
+
+	// Blobs are requested to the members that have them
+	c.Assert(second.connect(context.Background(), first.Self), qt.DeepEquals, (*NodeErr)(nil))
+	c.Assert(third.connect(context.Background(), first.Self), qt.DeepEquals, (*NodeErr)(nil))
+	data, err = second.Get(ctx, hash)
+	c.Assert(err, qt.IsNil)
+	c.Assert(data, qt.DeepEquals, content)
+
+	// Blobs received are announced to the network
+	c.Assert(waitFor(func() bool { return third.blobs.provided(hash, second.Self) }), qt.IsTrue)
+
+	// Corrupted chunks are requested to other members
+	corrupted := first.blobs.get(hash)
+	corrupted.data = bytes.ToUpper(corrupted.data)
+	data, err = third.Get(ctx, hash)
+	c.Assert(err, qt.IsNil)
+	c.Assert(data, qt.DeepEquals, content)
+
+	// Blobs that no member has are not found
+	missing := sha256.Sum256([]byte("missing"))
+	_, err = third.Get(ctx, missing[:])
+	c.Assert(errors.Is(err, ErrBlobNotFound), qt.IsTrue)
+
+	// Blobs are corrupted if no member has the valid content
+	fourth := initMemoryNode(t, network, 5003)
+	c.Assert(fourth.connect(context.Background(), first.Self), qt.DeepEquals, (*NodeErr)(nil))
+	fourth.Members.Delete(second.Self)
+	fourth.Members.Delete(third.Self)
+	_, err = fourth.Get(ctx, hash)
+	c.Assert(errors.Is(err, ErrCorruptedBlob), qt.IsTrue)
+}
+
+func TestNodeBlobsFallback(t *testing.T) {
+	c := qt.New(t)
+
+	network := nettest.NewNetwork(1)
+	first := initMemoryNode(t, network, 5000)
+	second := initMemoryNode(t, network, 5001)
+	third := initMemoryNode(t, network, 5002)
+	fourth := initMemoryNode(t, network, 5003)
+	content := []byte("content addressed blob")
+
+	// Most members respond with the manifest of other content
+	hash := first.Put(content)
+	bogus := []byte("bogus")
+	sum := sha256.Sum256(bogus)
+	for _, n := range []*Node{second, third} {
+		m := &manifest{Size: len(bogus), ChunkSize: len(bogus), Chunks: [][]byte{sum[:]}}
+		n.store(hash, &blob{data: bogus, manifest: m})
+		c.Assert(n.connect(context.Background(), first.Self), qt.DeepEquals, (*NodeErr)(nil))
+	}
+	c.Assert(fourth.connect(context.Background(), first.Self), qt.DeepEquals, (*NodeErr)(nil))
+
+	// The blob is received from the members with other manifest
+	data, err := fourth.Get(context.Background(), hash)
+	c.Assert(err, qt.IsNil)
+	c.Assert(data, qt.DeepEquals, content)
+
+	// Blobs larger than the maximum size are not requested
+	fifth := initMemoryNode(t, network, 5004)
+	WithMaxBlobSize(len(content) - 1)(fifth)
+	c.Assert(fifth.connect(context.Background(), first.Self), qt.DeepEquals, (*NodeErr)(nil))
+	fifth.Members.Delete(second.Self)
+	fifth.Members.Delete(third.Self)
+	fifth.Members.Delete(fourth.Self)
+	_, err = fifth.Get(context.Background(), hash)
+	c.Assert(errors.Is(err, ErrBlobNotFound), qt.IsTrue)
+}
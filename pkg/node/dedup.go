@@ -0,0 +1,76 @@
+package node
+
+import (
+	"sync"
+
+	"github.com/lucasmenendez/gop2p/pkg/message"
+)
+
+// defaultDedupSize contains the default number of message IDs remembered by
+// the node to discard duplicated messages.
+const defaultDedupSize = 1024
+
+// dedupCache struct contains a bounded set of the IDs of the messages already
+// received. When it is full, the oldest ID is forgotten to remember the new
+// one.
+type dedupCache struct {
+	ids   map[string]struct{}
+	order []string
+	next  int
+	mtx   *sync.Mutex
+}
+
+// newDedupCache function creates a dedupCache that remembers up to the
+// provided number of IDs.
+func newDedupCache(size int) *dedupCache {
+	return &dedupCache{
+		ids:   make(map[string]struct{}, size),
+		order: make([]string, size),
+		next:  0,
+		mtx:   &sync.Mutex{},
+	}
+}
+
+// seen function returns if the provided ID has been already seen, and
+// remembers it if not.
+func (c *dedupCache) seen(id string) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if _, ok := c.ids[id]; ok {
+		return true
+	}
+
+	if oldest := c.order[c.next]; oldest != "" {
+		delete(c.ids, oldest)
+	}
+	c.order[c.next] = id
+	c.next = (c.next + 1) % len(c.order)
+	c.ids[id] = struct{}{}
+	return false
+}
+
+// forget function forgets the provided ID, so it is not considered as seen
+// anymore.
+func (c *dedupCache) forget(id string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	delete(c.ids, id)
+}
+
+// duplicated function returns if the provided message has been already
+// received by the node, according to its ID. The messages without ID are never
+// considered duplicated.
+func (n *Node) duplicated(msg *message.Message) bool {
+	if n.dedup == nil || msg.ID == "" {
+		return false
+	}
+	return n.dedup.seen(msg.ID)
+}
+
+// undeliver function forgets the ID of the provided message, that could not
+// be delivered, so it is delivered if it is received again.
+func (n *Node) undeliver(msg *message.Message) {
+	if n.dedup != nil && msg.ID != "" {
+		n.dedup.forget(msg.ID)
+	}
+}
@@ -0,0 +1,62 @@
+package node
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/nettest"
+)
+
+func Test_dedupCache(t *testing.T) {
+	c := qt.New(t)
+
+	cache := newDedupCache(2)
+	c.Assert(cache.seen("a"), qt.IsFalse)
+	c.Assert(cache.seen("a"), qt.IsTrue)
+	c.Assert(cache.seen("b"), qt.IsFalse)
+
+	// The oldest ID is forgotten when the cache is full
+	c.Assert(cache.seen("c"), qt.IsFalse)
+	c.Assert(cache.seen("b"), qt.IsTrue)
+	c.Assert(cache.seen("a"), qt.IsFalse)
+	c.Assert(cache.ids, qt.HasLen, 2)
+}
+
+func TestNodeDuplicatedMessages(t *testing.T) {
+	c := qt.New(t)
+
+	network := nettest.NewNetwork(1)
+	receiver := initMemoryNode(t, network, 5000)
+	sender := initMemoryNode(t, network, 5001)
+	c.Assert(sender.connect(context.Background(), receiver.Self), qt.DeepEquals, (*NodeErr)(nil))
+
+	// The sender stamps the messages with an ID and a timestamp
+	msg := new(message.Message).SetFrom(sender.Self).SetData([]byte("first"))
+	go func() {
+		c.Assert(sender.broadcast(context.Background(), msg), qt.DeepEquals, (*NodeErr)(nil))
+	}()
+	received := <-receiver.Inbox
+	c.Assert(received.ID, qt.Not(qt.Equals), "")
+	c.Assert(received.ID, qt.Equals, msg.ID)
+	c.Assert(received.Timestamp, qt.Equals, msg.Timestamp)
+
+	// Retried messages are acknowledged but not delivered again, and the next
+	// message is delivered
+	_, err := network.Transport().Send(context.Background(), receiver.Self, msg)
+	c.Assert(err, qt.IsNil)
+	next := new(message.Message).SetFrom(sender.Self).SetData([]byte("second"))
+	go func() {
+		c.Assert(sender.broadcast(context.Background(), next), qt.DeepEquals, (*NodeErr)(nil))
+	}()
+	c.Assert((<-receiver.Inbox).Data, qt.DeepEquals, []byte("second"))
+
+	// Without duplicate suppression, every message is delivered
+	WithDedupCache(0)(receiver)
+	go func() {
+		_, err := network.Transport().Send(context.Background(), receiver.Self, msg)
+		c.Assert(err, qt.IsNil)
+	}()
+	c.Assert((<-receiver.Inbox).ID, qt.Equals, msg.ID)
+}
@@ -0,0 +1,261 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
+)
+
+const (
+	// defaultWorkers contains the default number of peers to which a node
+	// sends a message concurrently.
+	defaultWorkers = 16
+	// defaultPeerTimeout contains the default time that a node waits for the
+	// acknowledgement of a peer to which it sends a message.
+	defaultPeerTimeout = 10 * time.Second
+)
+
+// errDeliveryTimeout is returned when a peer does not acknowledge a message in
+// time.
+var errDeliveryTimeout = fmt.Errorf("delivery timeout")
+
+// DeliveryStatus identifies the result of the delivery of a message to a peer.
+type DeliveryStatus int
+
+const (
+	// Delivered identifies a message acknowledged by the peer.
+	Delivered DeliveryStatus = iota
+	// Failed identifies a message that could not be delivered to the peer or
+	// that the peer rejected.
+	Failed DeliveryStatus = iota
+	// TimedOut identifies a message that the peer did not acknowledge in time.
+	TimedOut DeliveryStatus = iota
+)
+
+// String function returns a human-readable version of the delivery status.
+func (s DeliveryStatus) String() string {
+	switch s {
+	case Delivered:
+		return "delivered"
+	case Failed:
+		return "failed"
+	case TimedOut:
+		return "timed out"
+	default:
+		return "unknown"
+	}
+}
+
+// Delivery struct contains the result of the delivery of a message to a peer:
+// its status, the number of attempts performed and the error of the last
+// attempt, if it was not delivered.
+type Delivery struct {
+	Peer     *peer.Peer
+	Status   DeliveryStatus
+	Attempts int
+	Err      error
+}
+
+// RetryPolicy struct defines how a message is delivered to each peer. Every
+// attempt waits up to Timeout for the acknowledgement of the peer (the node
+// per-peer timeout if it is zero). If the attempt fails or times out, it is
+// retried up to Attempts times in total, waiting between them an exponential
+// backoff that starts at InitialBackoff and it is doubled on every retry up to
+// MaxBackoff. The messages rejected by the peer are not retried.
+type RetryPolicy struct {
+	Attempts       int
+	Timeout        time.Duration
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy function returns a reliable RetryPolicy, that performs
+// up to five attempts with a timeout of five seconds each one, and a backoff
+// between 100 milliseconds and 5 seconds.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		Attempts:       5,
+		Timeout:        5 * time.Second,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+	}
+}
+
+// backoff function returns the time to wait before the provided attempt,
+// starting by 1.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 1; i < attempt && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
+
+// Deliver function sends the provided message to its intended peers, if it is
+// a direct message, or to every network member, and returns the result of the
+// delivery to each one. The message is sent concurrently to the peers, up to
+// the node workers limit at the same time. If a policy is provided, the
+// delivery to each peer is retried following it until the peer acknowledges
+// the message, otherwise the message is sent only once. The retried messages
+// keep their ID, so the receivers discard the duplicated ones. It returns an
+// error if the node is not connected or the message is not valid.
+func (n *Node) Deliver(msg *message.Message, policy *RetryPolicy) ([]*Delivery, error) {
+	if !n.IsConnected() {
+		return nil, ConnErr("node not connected", nil)
+	} else if msg.Type == message.DirectType && len(msg.To) == 0 {
+		return nil, InternalErr("no intended peer defined at provided message", nil)
+	} else if msg.Type != message.DirectType && msg.Type != message.BroadcastType {
+		return nil, InternalErr("only broadcast and direct messages can be delivered", nil)
+	}
+
+	n.prepare(msg)
+	if msg.JSON() == nil {
+		return nil, ParseErr("error encoding message to JSON", nil)
+	}
+	if policy == nil {
+		policy = &RetryPolicy{Attempts: 1}
+	}
+
+	recipients := msg.To
+	if msg.Type == message.BroadcastType {
+		recipients = n.Members.Peers()
+	}
+	return n.fanout(n.ctx, msg, recipients, policy), nil
+}
+
+// fanout function delivers the provided message to the provided peers
+// concurrently, following the provided policy, and returns the results in the
+// same order. No more than the node workers limit are sent at the same time.
+// Once the provided context is done, the message is not sent to the rest of
+// peers, that fail with the context error.
+func (n *Node) fanout(ctx context.Context, msg *message.Message, recipients []*peer.Peer, policy *RetryPolicy) []*Delivery {
+	deliveries := make([]*Delivery, len(recipients))
+	workers := make(chan struct{}, n.workers)
+	wg := &sync.WaitGroup{}
+	for i, to := range recipients {
+		if err := ctx.Err(); err != nil {
+			deliveries[i] = &Delivery{Peer: to, Status: Failed, Err: err}
+			continue
+		}
+		select {
+		case workers <- struct{}{}:
+		case <-ctx.Done():
+			deliveries[i] = &Delivery{Peer: to, Status: Failed, Err: ctx.Err()}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, to *peer.Peer) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			deliveries[i] = n.deliver(ctx, msg, to, policy)
+		}(i, to)
+	}
+	wg.Wait()
+	return deliveries
+}
+
+// deliver function sends the provided message to the provided peer following
+// the provided policy, until the provided context is done, and returns the
+// result.
+func (n *Node) deliver(ctx context.Context, msg *message.Message, to *peer.Peer, policy *RetryPolicy) *Delivery {
+	delivery := &Delivery{Peer: to, Status: Failed, Attempts: 0}
+	timeout := policy.Timeout
+	if timeout == 0 {
+		timeout = n.peerTimeout
+	}
+	toMsg, err := n.outgoing(msg, to)
+	if err != nil {
+		delivery.Err = err
+		return delivery
+	}
+
+	for delivery.Attempts < policy.Attempts || delivery.Attempts == 0 {
+		if delivery.Attempts > 0 {
+			// Wait before the next attempt, unless the context is done.
+			select {
+			case <-time.After(policy.backoff(delivery.Attempts)):
+			case <-ctx.Done():
+				return delivery
+			}
+		}
+
+		delivery.Attempts++
+		_, delivery.Err = n.sendWithin(ctx, to, toMsg, timeout)
+		switch {
+		case delivery.Err == nil:
+			delivery.Status = Delivered
+			return delivery
+		case errors.Is(delivery.Err, errDeliveryTimeout):
+			delivery.Status = TimedOut
+		case rejected(delivery.Err):
+			delivery.Status = Failed
+			return delivery
+		default:
+			delivery.Status = Failed
+		}
+	}
+	return delivery
+}
+
+// outgoing function returns the message to send to the provided peer: the
+// provided one, or a copy of it encrypted for the peer if the node has direct
+// message encryption enabled. It returns an error if the provided peer of a
+// direct message, a request, a call, a response or a stream chunk is not a
+// network member.
+func (n *Node) outgoing(msg *message.Message, to *peer.Peer) (*message.Message, *NodeErr) {
+	if msg.Type != message.DirectType && msg.Type != message.RequestType &&
+		msg.Type != message.CallType && msg.Type != message.ResponseType &&
+		msg.Type != message.ChunkType {
+		return msg, nil
+	}
+
+	member := n.Members.Get(to)
+	if member == nil {
+		// Return an error if the current network does not contains the
+		// Message.To peer provided
+		return nil, ConnErr("target peer is not into the network", nil)
+	} else if n.encDirect {
+		// If the node has direct message encryption enabled, encrypt a copy
+		// of the message for the intended peer and sign it again.
+		return n.encrypt(msg, member)
+	}
+	return msg, nil
+}
+
+// sendWithin function sends the provided message to the provided peer through
+// the node transport and returns its response, or an error if it is not
+// received before the provided timeout or the provided context is done, that
+// the transport stops at. If the timeout is zero, it waits until the transport
+// returns or the context is done.
+func (n *Node) sendWithin(ctx context.Context, to *peer.Peer, msg *message.Message, timeout time.Duration) ([]byte, error) {
+	if timeout <= 0 {
+		return n.transport.Send(ctx, to, msg)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	res, err := n.transport.Send(timeoutCtx, to, msg)
+	if err != nil && ctx.Err() == nil && errors.Is(timeoutCtx.Err(), context.DeadlineExceeded) {
+		return nil, errDeliveryTimeout
+	}
+	return res, err
+}
+
+// rejected function returns if the provided error means that the peer rejected
+// the message, so it must not be retried.
+func rejected(err error) bool {
+	return errors.Is(err, transport.ErrForbidden) ||
+		errors.Is(err, transport.ErrBadMessage) ||
+		errors.Is(err, transport.ErrNotAllowed)
+}
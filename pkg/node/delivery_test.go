@@ -0,0 +1,104 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/nettest"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+)
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	c := qt.New(t)
+
+	policy := &RetryPolicy{InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+	c.Assert(policy.backoff(1), qt.Equals, time.Millisecond)
+	c.Assert(policy.backoff(2), qt.Equals, 2*time.Millisecond)
+	c.Assert(policy.backoff(3), qt.Equals, 4*time.Millisecond)
+	c.Assert(policy.backoff(4), qt.Equals, 5*time.Millisecond)
+	c.Assert(policy.backoff(10), qt.Equals, 5*time.Millisecond)
+	c.Assert(DeliveryStatus(-1).String(), qt.Equals, "unknown")
+}
+
+func TestNodeDeliver(t *testing.T) {
+	c := qt.New(t)
+
+	network := nettest.NewNetwork(1)
+	sender := initMemoryNode(t, network, 5000)
+	first := initMemoryNode(t, network, 5001)
+	second := initMemoryNode(t, network, 5002)
+
+	msg := new(message.Message).SetFrom(sender.Self).SetData([]byte("job"))
+	_, err := sender.Deliver(msg, nil)
+	nodeErr := new(NodeErr)
+	c.Assert(errors.As(err, &nodeErr), qt.IsTrue)
+	c.Assert(nodeErr.ErrCode, qt.Equals, CONNECTION_ERR)
+
+	c.Assert(first.connect(context.Background(), sender.Self), qt.DeepEquals, (*NodeErr)(nil))
+	c.Assert(second.connect(context.Background(), sender.Self), qt.DeepEquals, (*NodeErr)(nil))
+	received := make(chan *message.Message, 10)
+	for _, n := range []*Node{first, second} {
+		go func(n *Node) {
+			for msg := range n.Inbox {
+				received <- msg
+			}
+		}(n)
+	}
+
+	// Each member reports its own result
+	network.Partition([]*peer.Peer{second.Self})
+	deliveries, err := sender.Deliver(msg, nil)
+	c.Assert(err, qt.IsNil)
+	c.Assert(deliveries, qt.HasLen, 2)
+	for _, delivery := range deliveries {
+		c.Assert(delivery.Attempts, qt.Equals, 1)
+		if delivery.Peer.Equal(first.Self) {
+			c.Assert(delivery.Status, qt.Equals, Delivered)
+			c.Assert(delivery.Err, qt.IsNil)
+		} else {
+			c.Assert(delivery.Status, qt.Equals, Failed)
+			c.Assert(delivery.Err, qt.IsNotNil)
+		}
+	}
+	c.Assert((<-received).Data, qt.DeepEquals, []byte("job"))
+	network.Heal()
+
+	// Reliable deliveries are retried until they are acknowledged, and
+	// delivered only once
+	network.SetDropRate(0.5)
+	policy := &RetryPolicy{Attempts: 20, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+	msg = new(message.Message).SetFrom(sender.Self).SetData([]byte("reliable")).SetTo(first.Self)
+	deliveries, err = sender.Deliver(msg, policy)
+	c.Assert(err, qt.IsNil)
+	c.Assert(deliveries, qt.HasLen, 1)
+	c.Assert(deliveries[0].Status, qt.Equals, Delivered)
+	c.Assert((<-received).Data, qt.DeepEquals, []byte("reliable"))
+	network.SetDropRate(0)
+
+	// Slow peers time out after every attempt, and the transport stops
+	// sending the message
+	network.SetLatency(50 * time.Millisecond)
+	policy = &RetryPolicy{Attempts: 2, Timeout: 10 * time.Millisecond, InitialBackoff: time.Millisecond}
+	msg = new(message.Message).SetFrom(sender.Self).SetData([]byte("slow")).SetTo(second.Self)
+	deliveries, err = sender.Deliver(msg, policy)
+	c.Assert(err, qt.IsNil)
+	c.Assert(deliveries[0].Status, qt.Equals, TimedOut)
+	c.Assert(deliveries[0].Attempts, qt.Equals, 2)
+	select {
+	case <-received:
+		t.Fatal("timed out message delivered")
+	case <-time.After(100 * time.Millisecond):
+	}
+	network.SetLatency(0)
+
+	// Messages to peers out of the network are not sent
+	unknown, _ := peer.New("localhost", 5003)
+	msg = new(message.Message).SetFrom(sender.Self).SetData([]byte("job")).SetTo(unknown)
+	deliveries, _ = sender.Deliver(msg, policy)
+	c.Assert(deliveries[0].Status, qt.Equals, Failed)
+	c.Assert(deliveries[0].Attempts, qt.Equals, 0)
+}
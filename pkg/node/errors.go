@@ -8,6 +8,7 @@ const (
 	CONNECTION_ERR = iota
 	PARSING_ERR    = iota
 	INTERNAL_ERR   = iota
+	REMOTE_ERR     = iota
 )
 
 type NodeErr struct {
@@ -22,6 +23,8 @@ func (err *NodeErr) Error() string {
 		tag = "connection error"
 	} else if err.ErrCode == PARSING_ERR {
 		tag = "parsing error"
+	} else if err.ErrCode == REMOTE_ERR {
+		tag = "remote error"
 	}
 
 	text := err.Text
@@ -33,6 +36,10 @@ func (err *NodeErr) Error() string {
 	return fmt.Sprintf("%s: %s", tag, text)
 }
 
+func (err *NodeErr) Unwrap() error {
+	return err.Trace
+}
+
 func ConnErr(text string, err error) *NodeErr {
 	return &NodeErr{CONNECTION_ERR, text, err}
 }
@@ -44,3 +51,7 @@ func ParseErr(text string, err error) *NodeErr {
 func InternalErr(text string, err error) *NodeErr {
 	return &NodeErr{INTERNAL_ERR, text, err}
 }
+
+func RemoteErr(text string, err error) *NodeErr {
+	return &NodeErr{REMOTE_ERR, text, err}
+}
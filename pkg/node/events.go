@@ -0,0 +1,113 @@
+package node
+
+import (
+	"fmt"
+
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+)
+
+// eventsBuffer contains the number of events that the Node.Events channel
+// keeps until they are read.
+const eventsBuffer = 64
+
+// EventType identifies the kind of change of the network members that an
+// Event reports.
+type EventType int
+
+const (
+	// PeerJoined identifies a peer that joins the network, connecting to the
+	// current node or known through other members.
+	PeerJoined EventType = iota
+	// PeerLeft identifies a peer that leaves the network gracefully, or that
+	// is no longer a member because the current node leaves it.
+	PeerLeft EventType = iota
+	// PeerSuspected identifies a member suspected to be failed by the failure
+	// detection.
+	PeerSuspected EventType = iota
+	// PeerRecovered identifies a suspected member that refutes the suspicion.
+	PeerRecovered EventType = iota
+	// PeerFailed identifies a member confirmed as failed by the failure
+	// detection, that is removed from the members.
+	PeerFailed EventType = iota
+)
+
+// String function returns a human-readable version of the event type.
+func (t EventType) String() string {
+	switch t {
+	case PeerJoined:
+		return "joined"
+	case PeerLeft:
+		return "left"
+	case PeerSuspected:
+		return "suspected"
+	case PeerRecovered:
+		return "recovered"
+	case PeerFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// Event struct contains a change of the network members: its type, the peer
+// affected and the reason of the change.
+type Event struct {
+	Type   EventType
+	Peer   *peer.Peer
+	Reason string
+}
+
+// String function returns a human-readable version of Event struct following
+// the format: '[peer.address:peer.port] type: reason'.
+func (e *Event) String() string {
+	return fmt.Sprintf("[%s] %s: %s", e.Peer.String(), e.Type, e.Reason)
+}
+
+// join function appends the provided peer to the current members, emitting
+// a PeerJoined event with the provided reason if it was not a member yet.
+func (n *Node) join(p *peer.Peer, reason string) {
+	if !n.Members.Contains(p) {
+		n.Members.Append(p)
+		n.emit(PeerJoined, p, reason)
+	}
+}
+
+// rejoin function registers the provided peer that connects to the current
+// node: it replaces the member equal to it, to update its information such as
+// its metadata, or joins it if it is not a member yet. The members with a
+// public key are not replaced by a peer without it.
+func (n *Node) rejoin(p *peer.Peer, reason string) {
+	if member := n.Members.Get(p); member != nil {
+		if member.PublicKey == nil || p.PublicKey != nil {
+			n.Members.Replace(p)
+		}
+		return
+	}
+	n.join(p, reason)
+}
+
+// leave function deletes the provided peer from the current members, and the
+// topics to which it is subscribed, emitting a PeerLeft event with the
+// provided reason if it was a member.
+func (n *Node) leave(p *peer.Peer, reason string) {
+	if member := n.Members.Get(p); member != nil {
+		n.Members.Delete(member)
+		n.pubsub.forget(member)
+		n.emit(PeerLeft, member, reason)
+	}
+}
+
+// emit function sends an event with the provided type, peer and reason to the
+// Node.Events channel. If the channel is full because the events are not
+// being read, the event is discarded to not block the node. The events are
+// not emitted once the node is stopped.
+func (n *Node) emit(t EventType, p *peer.Peer, reason string) {
+	if n.ctx.Err() != nil {
+		return
+	}
+
+	select {
+	case n.Events <- &Event{Type: t, Peer: p, Reason: reason}:
+	default:
+	}
+}
@@ -0,0 +1,96 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/lucasmenendez/gop2p/pkg/nettest"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+)
+
+// nextEvent function returns the next event of the provided node, failing if
+// it is not received after some time.
+func nextEvent(t *testing.T, n *Node) *Event {
+	select {
+	case event := <-n.Events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not received")
+		return nil
+	}
+}
+
+func TestEventType(t *testing.T) {
+	c := qt.New(t)
+
+	c.Assert(PeerJoined.String(), qt.Equals, "joined")
+	c.Assert(PeerFailed.String(), qt.Equals, "failed")
+	c.Assert(EventType(-1).String(), qt.Equals, "unknown")
+
+	p, _ := peer.New("localhost", 5000)
+	event := &Event{Type: PeerLeft, Peer: p, Reason: "disconnected"}
+	c.Assert(event.String(), qt.Equals, "[localhost:5000] left: disconnected")
+}
+
+func TestNodeEvents(t *testing.T) {
+	c := qt.New(t)
+
+	network := nettest.NewNetwork(1)
+	newNode := func(port int) *Node {
+		p, _ := peer.New("localhost", port)
+		n := New(p, WithTransport(network.Transport()), WithSWIM(testSWIMConfig()))
+		n.Start()
+		return n
+	}
+
+	entryPoint := newNode(5000)
+	first := newNode(5001)
+	second := newNode(5002)
+
+	// Connections are reported by the peers involved
+	c.Assert(first.connect(context.Background(), entryPoint.Self), qt.DeepEquals, (*NodeErr)(nil))
+	event := nextEvent(t, entryPoint)
+	c.Assert(event.Type, qt.Equals, PeerJoined)
+	c.Assert(event.Peer.Equal(first.Self), qt.IsTrue)
+	event = nextEvent(t, first)
+	c.Assert(event.Type, qt.Equals, PeerJoined)
+	c.Assert(event.Peer.Equal(entryPoint.Self), qt.IsTrue)
+
+	// Peers that connect again update their information
+	first.Self.Metadata = map[string]string{"role": "builder"}
+	c.Assert(first.connect(context.Background(), entryPoint.Self), qt.DeepEquals, (*NodeErr)(nil))
+	c.Assert(entryPoint.Members.Get(first.Self).Metadata, qt.DeepEquals, first.Self.Metadata)
+
+	c.Assert(second.connect(context.Background(), entryPoint.Self), qt.DeepEquals, (*NodeErr)(nil))
+	c.Assert(nextEvent(t, entryPoint).Peer.Equal(second.Self), qt.IsTrue)
+	c.Assert(nextEvent(t, first).Peer.Equal(second.Self), qt.IsTrue)
+	c.Assert(nextEvent(t, second).Type, qt.Equals, PeerJoined)
+	c.Assert(nextEvent(t, second).Type, qt.Equals, PeerJoined)
+
+	// A failed node is suspected and then confirmed as failed, forgetting
+	// its subscriptions
+	_, err := second.Subscribe("jobs")
+	c.Assert(err, qt.IsNil)
+	c.Assert(first.pubsub.subscribed(second.Self, "jobs"), qt.IsTrue)
+	network.Partition([]*peer.Peer{second.Self})
+	event = nextEvent(t, first)
+	c.Assert(event.Type, qt.Equals, PeerSuspected)
+	c.Assert(event.Peer.Equal(second.Self), qt.IsTrue)
+	event = nextEvent(t, first)
+	c.Assert(event.Type, qt.Equals, PeerFailed)
+	c.Assert(event.Peer.Equal(second.Self), qt.IsTrue)
+	c.Assert(first.pubsub.subscribed(second.Self, "jobs"), qt.IsFalse)
+	network.Heal()
+
+	// Graceful disconnections are reported as left peers
+	c.Assert(first.disconnect(context.Background()), qt.DeepEquals, (*NodeErr)(nil))
+	for event = nextEvent(t, entryPoint); event.Type != PeerLeft; event = nextEvent(t, entryPoint) {
+	}
+	c.Assert(event.Peer.Equal(first.Self), qt.IsTrue)
+	c.Assert(event.Reason, qt.Equals, "disconnected")
+	event = nextEvent(t, first)
+	c.Assert(event.Type, qt.Equals, PeerLeft)
+	c.Assert(event.Reason, qt.Equals, "node disconnected")
+}
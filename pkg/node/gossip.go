@@ -0,0 +1,141 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/bits"
+	"math/rand"
+
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
+)
+
+// defaultGossipFanout contains the default number of peers to which every node
+// forwards a gossiped message.
+const defaultGossipFanout = 3
+
+// gossipConfig struct contains the parameters of the epidemic dissemination
+// of the broadcast messages: the number of peers to which every node forwards
+// them and the maximum number of hops, or zero to compute it from the network
+// size.
+type gossipConfig struct {
+	fanout int
+	ttl    int
+}
+
+// gossipTTL function returns the number of hops of a gossiped message, the
+// provided one or, if it is zero, the one configured in the node. If neither
+// are defined, the TTL is computed from the network size to reach every member
+// with high probability.
+func (n *Node) gossipTTL(ttl int) int {
+	if ttl <= 0 && n.gossip != nil {
+		ttl = n.gossip.ttl
+	}
+	if ttl <= 0 {
+		ttl = bits.Len(uint(n.Members.Len()+1)) + 1
+	}
+	return ttl
+}
+
+// gossipFanout function returns the number of peers to which the node
+// forwards the gossiped messages.
+func (n *Node) gossipFanout() int {
+	if n.gossip != nil && n.gossip.fanout > 0 {
+		return n.gossip.fanout
+	}
+	return defaultGossipFanout
+}
+
+// disseminate function sends the provided broadcast message to a random subset
+// of the network members, that forward it to other ones until its TTL
+// expires. The message is prepared and remembered as already received, to
+// discard it when other members forward it back. It returns an error that
+// collects the errors of every peer that does not receive it, only if no peer
+// receives it.
+func (n *Node) disseminate(ctx context.Context, msg *message.Message) *NodeErr {
+	msg.TTL = n.gossipTTL(msg.TTL)
+	n.prepare(msg)
+	if msg.JSON() == nil {
+		return ParseErr("error encoding message to JSON", nil)
+	}
+	n.duplicated(msg)
+
+	deliveries, err := n.forward(ctx, msg, msg.TTL, nil)
+	if err != nil {
+		return err
+	}
+	errs := []error{}
+	for _, delivery := range deliveries {
+		if delivery.Status == Delivered {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", delivery.Peer, delivery.Err))
+	}
+	if len(errs) > 0 {
+		return ConnErr("error trying to perform the request", errors.Join(errs...))
+	}
+	return nil
+}
+
+// forward function wraps the provided broadcast message into a gossip message
+// with the provided number of hops left and sends it to a random subset of the
+// network members, excluding its origin and the provided peer, from which it
+// was received, until the provided context is done. It returns the result of
+// the delivery to each one.
+func (n *Node) forward(ctx context.Context, msg *message.Message, ttl int, from *peer.Peer) ([]*Delivery, *NodeErr) {
+	data := msg.JSON()
+	if data == nil {
+		return nil, ParseErr("error encoding message to JSON", nil)
+	}
+	wrapper := new(message.Message).SetType(message.GossipType).SetFrom(n.Self)
+	wrapper.Data, wrapper.TTL = data, ttl
+	n.prepare(wrapper)
+
+	targets := n.Members.Select(func(p *peer.Peer) bool {
+		return !p.Equal(msg.From) && (from == nil || !p.Equal(from))
+	})
+	rand.Shuffle(len(targets), func(i, j int) {
+		targets[i], targets[j] = targets[j], targets[i]
+	})
+	if fanout := n.gossipFanout(); len(targets) > fanout {
+		targets = targets[:fanout]
+	}
+	return n.fanout(ctx, wrapper, targets, &RetryPolicy{Attempts: 1}), nil
+}
+
+// handleGossip function handles the gossip messages received. It checks the
+// member that forwards the message and unwraps the broadcast message
+// contained, checking its origin too. If the broadcast message has not been
+// received yet, it is forwarded to other members while it has hops left and
+// it is delivered to Node.Inbox.
+func (n *Node) handleGossip(msg *message.Message) ([]byte, error) {
+	if err := n.verifySender(msg); err != nil {
+		return nil, err
+	}
+	n.applyUpdates(msg.Updates)
+
+	inner := new(message.Message).SetJSON(msg.Data)
+	if inner == nil || inner.From == nil || inner.Type != message.BroadcastType {
+		return nil, fmt.Errorf("%w: no valid gossiped message", transport.ErrBadMessage)
+	} else if inner.From.Equal(n.Self) {
+		// The node receives back its own message, ignore it.
+		return nil, nil
+	} else if err := n.verifySender(inner); err != nil {
+		return nil, err
+	} else if n.duplicated(inner) {
+		return nil, nil
+	}
+
+	if msg.TTL > 1 {
+		// Forward the message in background to not delay the response to the
+		// sender.
+		go n.forward(n.ctx, inner, msg.TTL-1, msg.From)
+	}
+	if err := n.push(inner); err != nil {
+		n.undeliver(inner)
+		return nil, err
+	}
+	return nil, nil
+}
@@ -0,0 +1,95 @@
+package node
+
+import (
+	"context"
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/nettest"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+)
+
+func TestNodeGossip(t *testing.T) {
+	c := qt.New(t)
+
+	// Create a network of signed nodes where the origin does not know one of
+	// the members, so it can only receive the messages forwarded by others
+	network := nettest.NewNetwork(1)
+	nodes := []*Node{}
+	for port := 5000; port < 5005; port++ {
+		p, err := peer.New("localhost", port)
+		c.Assert(err, qt.IsNil)
+		_, key, _ := ed25519.GenerateKey(nil)
+		n := New(p, WithTransport(network.Transport()), WithKey(key))
+		n.Start()
+		nodes = append(nodes, n)
+	}
+	for _, n := range nodes[1:] {
+		c.Assert(n.connect(context.Background(), nodes[0].Self), qt.DeepEquals, (*NodeErr)(nil))
+	}
+	origin, hidden := nodes[1], nodes[4]
+	origin.Members.Delete(origin.Members.Get(hidden.Self))
+
+	received := make(chan *message.Message, 20)
+	for _, n := range nodes {
+		go func(n *Node) {
+			for msg := range n.Inbox {
+				received <- msg
+			}
+		}(n)
+	}
+	expectAll := func(data []byte) {
+		for range nodes[1:] {
+			select {
+			case msg := <-received:
+				c.Assert(msg.Data, qt.DeepEquals, data)
+				c.Assert(msg.From.Equal(origin.Self), qt.IsTrue)
+			case <-time.After(time.Second):
+				t.Fatal("gossiped message not received")
+			}
+		}
+		select {
+		case <-received:
+			t.Fatal("duplicated message delivered")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	// The messages with TTL are gossiped by the members
+	msg := new(message.Message).SetFrom(origin.Self).SetData([]byte("per message"))
+	msg.TTL = 3
+	c.Assert(origin.broadcast(context.Background(), msg), qt.DeepEquals, (*NodeErr)(nil))
+	expectAll([]byte("per message"))
+
+	// The nodes with gossip enabled gossip every broadcast message
+	WithGossip(3, 0)(origin)
+	msg = new(message.Message).SetFrom(origin.Self).SetData([]byte("per node"))
+	c.Assert(origin.broadcast(context.Background(), msg), qt.DeepEquals, (*NodeErr)(nil))
+	c.Assert(msg.TTL > 0, qt.IsTrue)
+	expectAll([]byte("per node"))
+
+	// Without hops left, the message is not forwarded to the hidden member
+	msg = new(message.Message).SetFrom(origin.Self).SetData([]byte("one hop"))
+	msg.TTL = 1
+	c.Assert(origin.broadcast(context.Background(), msg), qt.DeepEquals, (*NodeErr)(nil))
+	for range nodes[1:4] {
+		c.Assert((<-received).Data, qt.DeepEquals, []byte("one hop"))
+	}
+	select {
+	case <-received:
+		t.Fatal("message forwarded without hops left")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The gossiped messages with a forged origin are rejected
+	forged := new(message.Message).SetFrom(origin.Self).SetData([]byte("forged"))
+	forged.Stamp()
+	wrapper := new(message.Message).SetType(message.GossipType).SetFrom(nodes[0].Self)
+	wrapper.Data, wrapper.TTL = forged.JSON(), 1
+	nodes[0].sign(wrapper)
+	_, err := network.Transport().Send(context.Background(), nodes[2].Self, wrapper)
+	c.Assert(err, qt.IsNotNil)
+}
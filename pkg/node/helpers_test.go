@@ -1,6 +1,7 @@
 package node
 
 import (
+	"bytes"
 	"crypto/rand"
 	"math/big"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 
 	qt "github.com/frankban/quicktest"
 	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/nettest"
 	"github.com/lucasmenendez/gop2p/pkg/peer"
 )
 
@@ -37,6 +39,18 @@ func initNode(t *testing.T, port int) *Node {
 	return n
 }
 
+func initMemoryNode(t *testing.T, network *nettest.Network, port int) *Node {
+	c := qt.New(t)
+
+	// Init and start the node over the provided virtual network
+	p, err := peer.New("localhost", port)
+	c.Assert(err, qt.IsNil)
+	n := New(p, WithTransport(network.Transport()))
+	n.Start()
+
+	return n
+}
+
 func prepareRequest(t *testing.T, reqType, to, from int, data []byte) *http.Request {
 	c := qt.New(t)
 
@@ -53,8 +67,9 @@ func prepareRequest(t *testing.T, reqType, to, from int, data []byte) *http.Requ
 		msg.SetTo(toPeer)
 	}
 
-	req, err := composeRequest(msg, toPeer)
+	req, err := http.NewRequest(http.MethodPost, toPeer.Hostname(), bytes.NewBuffer(msg.JSON()))
 	c.Assert(err, qt.IsNil)
+	req.Host = msg.From.String()
 
 	return req
 }
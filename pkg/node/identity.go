@@ -0,0 +1,122 @@
+package node
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
+)
+
+const (
+	// proofContext contains the prefix of the content signed to prove the
+	// possession of a private key during the connection handshake.
+	proofContext string = "gop2p-connect"
+	// proofWindow contains the maximum age accepted of a connection proof.
+	proofWindow = time.Minute
+)
+
+// connectProof function returns the proof of possession of the current node
+// private key to include in the connection messages. The proof contains the
+// current timestamp (8 bytes, big endian unix seconds) followed by the
+// signature of the node identity and address and the timestamp.
+func (n *Node) connectProof() []byte {
+	timestamp := binary.BigEndian.AppendUint64(nil, uint64(time.Now().Unix()))
+	signature := ed25519.Sign(n.key, proofPayload(n.Self, timestamp))
+	return append(timestamp, signature...)
+}
+
+// verifyConnectProof function checks that the provided connection message
+// includes a recent proof of possession of the private key associated to the
+// public key of the sender.
+func verifyConnectProof(msg *message.Message) error {
+	if len(msg.From.PublicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("no valid public key provided")
+	} else if len(msg.Data) != 8+ed25519.SignatureSize {
+		return fmt.Errorf("no valid connection proof provided")
+	}
+
+	timestamp, signature := msg.Data[:8], msg.Data[8:]
+	created := time.Unix(int64(binary.BigEndian.Uint64(timestamp)), 0)
+	if age := time.Since(created); age > proofWindow || age < -proofWindow {
+		return fmt.Errorf("connection proof expired")
+	}
+	if !ed25519.Verify(msg.From.PublicKey, proofPayload(msg.From, timestamp), signature) {
+		return fmt.Errorf("no valid connection proof signature")
+	}
+	return nil
+}
+
+// proofPayload function returns the content signed by the provided peer to
+// prove the possession of its private key at the provided timestamp.
+func proofPayload(from *peer.Peer, timestamp []byte) []byte {
+	return bytes.Join([][]byte{
+		[]byte(proofContext),
+		[]byte(from.ID()),
+		[]byte(from.String()),
+		timestamp,
+	}, []byte("|"))
+}
+
+// sign function signs the provided message with the current node private key,
+// if the node has identity.
+func (n *Node) sign(msg *message.Message) {
+	if n.key != nil {
+		msg.Sign(n.key)
+	}
+}
+
+// verifySender function checks that the sender of the provided message is a
+// registered member of the network and, if it has identity, that the message
+// signature is valid for its known public key, not for the one declared in
+// the message. The connection messages are verified against the declared key,
+// because its possession is proved during the handshake.
+func (n *Node) verifySender(msg *message.Message) error {
+	sender := msg.From
+	if msg.Type != message.ConnectType {
+		if sender = n.Members.Get(msg.From); sender == nil {
+			return transport.ErrForbidden
+		}
+	}
+
+	if sender.PublicKey != nil && !msg.Verify(sender.PublicKey) {
+		return fmt.Errorf("%w: no valid message signature", transport.ErrForbidden)
+	}
+	return nil
+}
+
+// encrypt function returns a signed copy of the provided message with its data
+// encrypted for the provided member. It returns an error if the member does
+// not accept encrypted messages.
+func (n *Node) encrypt(msg *message.Message, to *peer.Peer) (*message.Message, *NodeErr) {
+	if to.EncryptionKey == nil {
+		return nil, InternalErr("target peer does not accept encrypted messages", nil)
+	}
+
+	encMsg := *msg
+	if _, err := encMsg.Encrypt(to.EncryptionKey); err != nil {
+		return nil, InternalErr("error encrypting message", err)
+	}
+	n.sign(&encMsg)
+	return &encMsg, nil
+}
+
+// decrypt function decrypts the provided message data if it is encrypted. It
+// returns an error if the current node has not encryption enabled or the data
+// can not be decrypted.
+func (n *Node) decrypt(msg *message.Message) error {
+	if !msg.Encrypted {
+		return nil
+	} else if n.encKey == nil {
+		return fmt.Errorf("%w: encrypted messages not accepted", transport.ErrBadMessage)
+	}
+
+	if _, err := msg.Decrypt(n.encKey); err != nil {
+		return fmt.Errorf("%w: %v", transport.ErrBadMessage, err)
+	}
+	return nil
+}
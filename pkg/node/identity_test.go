@@ -0,0 +1,236 @@
+package node
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/nettest"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
+)
+
+func Test_connectProof(t *testing.T) {
+	c := qt.New(t)
+
+	_, key, _ := ed25519.GenerateKey(nil)
+	me, _ := peer.Me(getRandomPort(), false)
+	n := New(me, WithKey(key))
+	c.Assert(n.Self.PublicKey, qt.DeepEquals, key.Public())
+
+	msg := new(message.Message).SetType(message.ConnectType).SetFrom(n.Self)
+	msg.Data = n.connectProof()
+	c.Assert(verifyConnectProof(msg), qt.IsNil)
+
+	// Other sender address
+	other := *n.Self
+	other.Port++
+	msg.From = &other
+	c.Assert(verifyConnectProof(msg), qt.IsNotNil)
+
+	// Other public key
+	otherKey, _, _ := ed25519.GenerateKey(nil)
+	msg.From = &peer.Peer{Address: me.Address, Port: me.Port, PublicKey: otherKey}
+	c.Assert(verifyConnectProof(msg), qt.IsNotNil)
+
+	// Expired proof
+	msg.From = n.Self
+	timestamp := binary.BigEndian.AppendUint64(nil, uint64(time.Now().Add(-2*proofWindow).Unix()))
+	msg.Data = append(timestamp, ed25519.Sign(key, proofPayload(n.Self, timestamp))...)
+	c.Assert(verifyConnectProof(msg), qt.ErrorMatches, "connection proof expired")
+
+	// No proof
+	msg.Data = nil
+	c.Assert(verifyConnectProof(msg), qt.IsNotNil)
+}
+
+func TestNodeIdentity(t *testing.T) {
+	c := qt.New(t)
+
+	network := nettest.NewNetwork(1)
+	newNode := func(port int, withKey bool) *Node {
+		p, _ := peer.New("localhost", port)
+		opts := []Option{WithTransport(network.Transport())}
+		if withKey {
+			_, key, _ := ed25519.GenerateKey(nil)
+			opts = append(opts, WithKey(key))
+		}
+		n := New(p, opts...)
+		n.Start()
+		return n
+	}
+
+	entryPoint := newNode(5000, true)
+	member := newNode(5001, true)
+	c.Assert(member.connect(context.Background(), entryPoint.Self), qt.DeepEquals, (*NodeErr)(nil))
+	c.Assert(entryPoint.Members.Contains(member.Self), qt.IsTrue)
+
+	// Peers without identity are rejected
+	anonymous := newNode(5002, false)
+	err := anonymous.connect(context.Background(), entryPoint.Self)
+	c.Assert(err, qt.IsNotNil)
+	c.Assert(err.Trace, qt.ErrorIs, transport.ErrForbidden)
+
+	// Peers that claim other identity are rejected
+	impostor := newNode(5003, false)
+	impostor.Self.PublicKey = member.Self.PublicKey
+	msg := new(message.Message).SetType(message.ConnectType).SetFrom(impostor.Self)
+	_, sendErr := impostor.transport.Send(context.Background(), entryPoint.Self, msg)
+	c.Assert(sendErr, qt.ErrorIs, transport.ErrForbidden)
+	msg.Data = member.connectProof()
+	_, sendErr = impostor.transport.Send(context.Background(), entryPoint.Self, msg)
+	c.Assert(sendErr, qt.ErrorIs, transport.ErrForbidden)
+
+	// Peers without identity announced by other members are ignored
+	WithSWIM(testSWIMConfig())(entryPoint)
+	announced, _ := peer.New("localhost", 5004)
+	announced.PublicKey, _, _ = ed25519.GenerateKey(nil)
+	entryPoint.applyUpdates([]*peer.Update{
+		{Peer: anonymous.Self, State: peer.Alive, Incarnation: 1},
+		{Peer: announced, State: peer.Alive, Incarnation: 1},
+	})
+	c.Assert(entryPoint.Members.Contains(anonymous.Self), qt.IsFalse)
+	c.Assert(entryPoint.Members.Contains(announced), qt.IsTrue)
+}
+
+func TestNodeSignedMessages(t *testing.T) {
+	c := qt.New(t)
+
+	network := nettest.NewNetwork(1)
+	newNode := func(port int) *Node {
+		p, _ := peer.New("localhost", port)
+		_, key, _ := ed25519.GenerateKey(nil)
+		n := New(p, WithTransport(network.Transport()), WithKey(key))
+		n.Start()
+		return n
+	}
+
+	entryPoint := newNode(5000)
+	member := newNode(5001)
+	c.Assert(member.connect(context.Background(), entryPoint.Self), qt.DeepEquals, (*NodeErr)(nil))
+
+	// Signed messages from members are delivered
+	data := []byte("signed")
+	go func() {
+		msg := new(message.Message).SetFrom(member.Self).SetData(data)
+		c.Assert(member.broadcast(context.Background(), msg), qt.DeepEquals, (*NodeErr)(nil))
+	}()
+	received := <-entryPoint.Inbox
+	c.Assert(received.Data, qt.DeepEquals, data)
+	c.Assert(received.Verify(member.Self.PublicKey), qt.IsTrue)
+
+	// Unsigned messages are rejected
+	attacker := network.Transport()
+	msg := new(message.Message).SetFrom(member.Self).SetData(data)
+	_, err := attacker.Send(context.Background(), entryPoint.Self, msg)
+	c.Assert(err, qt.ErrorIs, transport.ErrForbidden)
+
+	// Messages signed with other key are rejected, even if the sender
+	// declares that key or no key at all
+	otherKey, key, _ := ed25519.GenerateKey(nil)
+	forged := &peer.Peer{Address: member.Self.Address, Port: member.Self.Port}
+	msg = new(message.Message).SetFrom(forged).SetData(data).Sign(key)
+	_, err = attacker.Send(context.Background(), entryPoint.Self, msg)
+	c.Assert(err, qt.ErrorIs, transport.ErrForbidden)
+
+	forged.PublicKey = otherKey
+	msg = new(message.Message).SetFrom(forged).SetData(data).Sign(key)
+	_, err = attacker.Send(context.Background(), entryPoint.Self, msg)
+	c.Assert(err, qt.ErrorIs, transport.ErrForbidden)
+
+	// Messages with tampered data are rejected
+	msg = new(message.Message).SetFrom(member.Self).SetData(data).Sign(member.key)
+	msg.Data = []byte("tampered")
+	_, err = attacker.Send(context.Background(), entryPoint.Self, msg)
+	c.Assert(err, qt.ErrorIs, transport.ErrForbidden)
+}
+
+func TestNodeEncryptedMessages(t *testing.T) {
+	c := qt.New(t)
+
+	network := nettest.NewNetwork(1)
+	newNode := func(port int, encryption bool) *Node {
+		p, _ := peer.New("localhost", port)
+		_, key, _ := ed25519.GenerateKey(nil)
+		opts := []Option{WithTransport(network.Transport()), WithKey(key)}
+		if encryption {
+			encKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+			opts = append(opts, WithEncryption(encKey))
+		}
+		n := New(p, opts...)
+		n.Start()
+		return n
+	}
+
+	entryPoint := newNode(5000, true)
+	member := newNode(5001, true)
+	plain := newNode(5002, false)
+	c.Assert(member.connect(context.Background(), entryPoint.Self), qt.DeepEquals, (*NodeErr)(nil))
+	c.Assert(plain.connect(context.Background(), entryPoint.Self), qt.DeepEquals, (*NodeErr)(nil))
+
+	// Direct messages are delivered decrypted
+	data := []byte("credentials")
+	msg := new(message.Message).SetFrom(member.Self).SetData(data).SetTo(entryPoint.Self)
+	go func() {
+		c.Assert(member.send(context.Background(), msg), qt.DeepEquals, (*NodeErr)(nil))
+	}()
+	received := <-entryPoint.Inbox
+	c.Assert(received.Data, qt.DeepEquals, data)
+	c.Assert(received.Encrypted, qt.IsFalse)
+	c.Assert(msg.Data, qt.DeepEquals, data)
+
+	// Peers without encryption key can not receive encrypted messages
+	msg = new(message.Message).SetFrom(member.Self).SetData(data).SetTo(plain.Self)
+	err := member.send(context.Background(), msg)
+	c.Assert(err, qt.IsNotNil)
+	c.Assert(err.ErrCode, qt.Equals, INTERNAL_ERR)
+
+	// Nodes without encryption reject encrypted messages
+	msg = new(message.Message).SetFrom(entryPoint.Self).SetData(data).SetTo(plain.Self)
+	msg.Encrypt(member.Self.EncryptionKey)
+	msg.Sign(entryPoint.key)
+	_, sendErr := network.Transport().Send(context.Background(), plain.Self, msg)
+	c.Assert(sendErr, qt.ErrorIs, transport.ErrBadMessage)
+}
+
+func TestNodeSecureSessions(t *testing.T) {
+	c := qt.New(t)
+
+	network := nettest.NewNetwork(1)
+	newNode := func(port int) *Node {
+		p, _ := peer.New("localhost", port)
+		_, key, _ := ed25519.GenerateKey(nil)
+		encKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+		n := New(p, WithTransport(network.Transport()), WithKey(key), WithSecureSessions(encKey))
+		n.Start()
+		return n
+	}
+
+	entryPoint := newNode(5000)
+	member := newNode(5001)
+	other := newNode(5002)
+	c.Assert(member.connect(context.Background(), entryPoint.Self), qt.DeepEquals, (*NodeErr)(nil))
+	c.Assert(other.connect(context.Background(), entryPoint.Self), qt.DeepEquals, (*NodeErr)(nil))
+	c.Assert(entryPoint.Members.Len(), qt.Equals, 2)
+
+	// Every message is exchanged through the sessions without changes
+	data := []byte("hello")
+	msg := new(message.Message).SetFrom(member.Self).SetData(data).SetTo(other.Self)
+	go func() {
+		c.Assert(member.send(context.Background(), msg), qt.DeepEquals, (*NodeErr)(nil))
+	}()
+	received := <-other.Inbox
+	c.Assert(received.Data, qt.DeepEquals, data)
+	c.Assert(received.Encrypted, qt.IsFalse)
+
+	// Nodes with secure sessions reject plain messages
+	msg = new(message.Message).SetFrom(member.Self).SetData(data).Sign(member.key)
+	_, err := network.Transport().Send(context.Background(), entryPoint.Self, msg)
+	c.Assert(err, qt.ErrorIs, transport.ErrForbidden)
+}
@@ -0,0 +1,114 @@
+package node
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
+)
+
+// InboxPolicy identifies what a node does with the messages received when its
+// Node.Inbox channel is full.
+type InboxPolicy int
+
+const (
+	// InboxBlock waits until the message can be delivered, blocking the
+	// sender until then.
+	InboxBlock InboxPolicy = iota
+	// InboxDropOldest discards the oldest message of the inbox to deliver the
+	// received one.
+	InboxDropOldest InboxPolicy = iota
+	// InboxDropNewest discards the received message.
+	InboxDropNewest InboxPolicy = iota
+	// InboxReject rejects the received message with a transport.ErrUnavailable
+	// error, so the sender can retry it later.
+	InboxReject InboxPolicy = iota
+)
+
+// String function returns a human-readable version of the inbox policy.
+func (p InboxPolicy) String() string {
+	switch p {
+	case InboxBlock:
+		return "block"
+	case InboxDropOldest:
+		return "drop oldest"
+	case InboxDropNewest:
+		return "drop newest"
+	case InboxReject:
+		return "reject"
+	default:
+		return "unknown"
+	}
+}
+
+// InboxStats struct contains the number of messages delivered to the
+// Node.Inbox channel, the ones discarded because it was full, and the ones
+// rejected because of the same reason.
+type InboxStats struct {
+	Delivered uint64
+	Dropped   uint64
+	Rejected  uint64
+}
+
+// inbox struct contains the policy applied when the Node.Inbox channel is
+// full and the counters of the messages delivered, dropped and rejected.
+type inbox struct {
+	policy    InboxPolicy
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+	rejected  atomic.Uint64
+}
+
+// InboxStats function returns the number of messages delivered to the
+// Node.Inbox channel, dropped and rejected since the node was created.
+func (n *Node) InboxStats() InboxStats {
+	return InboxStats{
+		Delivered: n.inbox.delivered.Load(),
+		Dropped:   n.inbox.dropped.Load(),
+		Rejected:  n.inbox.rejected.Load(),
+	}
+}
+
+// push function delivers the provided message to the Node.Inbox channel,
+// following the inbox policy of the node if it is full. It returns an error
+// only if the message is rejected.
+func (n *Node) push(msg *message.Message) error {
+	if n.inbox.policy == InboxBlock {
+		n.Inbox <- msg
+		n.inbox.delivered.Add(1)
+		return nil
+	}
+
+	for {
+		select {
+		case n.Inbox <- msg:
+			n.inbox.delivered.Add(1)
+			return nil
+		default:
+		}
+
+		switch n.inbox.policy {
+		case InboxReject:
+			n.inbox.rejected.Add(1)
+			return fmt.Errorf("%w: inbox full", transport.ErrUnavailable)
+		case InboxDropOldest:
+			// Discard the oldest message, if any, and try again. An
+			// unbuffered inbox has no messages to discard, so the received
+			// one is discarded instead.
+			if cap(n.Inbox) > 0 {
+				select {
+				case <-n.Inbox:
+					n.inbox.dropped.Add(1)
+				default:
+				}
+				continue
+			}
+			n.inbox.dropped.Add(1)
+			return nil
+		default:
+			n.inbox.dropped.Add(1)
+			return nil
+		}
+	}
+}
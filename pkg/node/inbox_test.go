@@ -0,0 +1,101 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/nettest"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
+)
+
+func TestInboxPolicy(t *testing.T) {
+	c := qt.New(t)
+
+	c.Assert(InboxBlock.String(), qt.Equals, "block")
+	c.Assert(InboxDropOldest.String(), qt.Equals, "drop oldest")
+	c.Assert(InboxDropNewest.String(), qt.Equals, "drop newest")
+	c.Assert(InboxReject.String(), qt.Equals, "reject")
+	c.Assert(InboxPolicy(-1).String(), qt.Equals, "unknown")
+}
+
+func TestNodeInbox(t *testing.T) {
+	c := qt.New(t)
+
+	network := nettest.NewNetwork(1)
+	sender := initMemoryNode(t, network, 5000)
+	broadcast := func(data string) *NodeErr {
+		msg := new(message.Message).SetFrom(sender.Self).SetData([]byte(data))
+		return sender.broadcast(context.Background(), msg)
+	}
+	receiver := func(port int, policy InboxPolicy) *Node {
+		p, _ := peer.New("localhost", port)
+		n := New(p, WithTransport(network.Transport()), WithInbox(2, policy))
+		n.Start()
+		c.Assert(n.connect(context.Background(), sender.Self), qt.DeepEquals, (*NodeErr)(nil))
+		return n
+	}
+	drain := func(n *Node) []string {
+		data := []string{}
+		for len(n.Inbox) > 0 {
+			data = append(data, string((<-n.Inbox).Data))
+		}
+		return data
+	}
+
+	// Dropping the oldest messages keeps the newest ones
+	dropOldest := receiver(5001, InboxDropOldest)
+	for i := 0; i < 5; i++ {
+		c.Assert(broadcast(fmt.Sprint(i)), qt.DeepEquals, (*NodeErr)(nil))
+	}
+	c.Assert(drain(dropOldest), qt.DeepEquals, []string{"3", "4"})
+	c.Assert(dropOldest.InboxStats(), qt.Equals, InboxStats{Delivered: 5, Dropped: 3})
+	sender.leave(dropOldest.Self, "test")
+
+	// Dropping the newest messages keeps the oldest ones
+	dropNewest := receiver(5002, InboxDropNewest)
+	for i := 0; i < 5; i++ {
+		c.Assert(broadcast(fmt.Sprint(i)), qt.DeepEquals, (*NodeErr)(nil))
+	}
+	c.Assert(drain(dropNewest), qt.DeepEquals, []string{"0", "1"})
+	c.Assert(dropNewest.InboxStats(), qt.Equals, InboxStats{Delivered: 2, Dropped: 3})
+	sender.leave(dropNewest.Self, "test")
+
+	// Rejected messages are reported to the sender, and delivered if they are
+	// retried when the inbox has room
+	reject := receiver(5003, InboxReject)
+	c.Assert(broadcast("0"), qt.DeepEquals, (*NodeErr)(nil))
+	c.Assert(broadcast("1"), qt.DeepEquals, (*NodeErr)(nil))
+	msg := new(message.Message).SetFrom(sender.Self).SetData([]byte("2"))
+	err := sender.broadcast(context.Background(), msg)
+	c.Assert(err, qt.IsNotNil)
+	c.Assert(err, qt.ErrorIs, transport.ErrUnavailable)
+	c.Assert(drain(reject), qt.DeepEquals, []string{"0", "1"})
+	_, sendErr := network.Transport().Send(context.Background(), reject.Self, msg)
+	c.Assert(sendErr, qt.IsNil)
+	c.Assert(drain(reject), qt.DeepEquals, []string{"2"})
+	c.Assert(reject.InboxStats(), qt.Equals, InboxStats{Delivered: 3, Rejected: 1})
+	sender.leave(reject.Self, "test")
+
+	// Blocking waits until the inbox has room
+	block := receiver(5004, InboxBlock)
+	c.Assert(broadcast("0"), qt.DeepEquals, (*NodeErr)(nil))
+	c.Assert(broadcast("1"), qt.DeepEquals, (*NodeErr)(nil))
+	done := make(chan *NodeErr)
+	go func() {
+		done <- broadcast("2")
+	}()
+	select {
+	case <-done:
+		t.Fatal("message delivered to a full inbox")
+	case <-time.After(50 * time.Millisecond):
+	}
+	c.Assert(string((<-block.Inbox).Data), qt.Equals, "0")
+	c.Assert(<-done, qt.DeepEquals, (*NodeErr)(nil))
+	c.Assert(drain(block), qt.DeepEquals, []string{"1", "2"})
+	c.Assert(block.InboxStats(), qt.Equals, InboxStats{Delivered: 3})
+}
@@ -1,9 +1,10 @@
 // node package contains the logic to keep listening to incoming messages while
 // cocurrently allows to the user to perform connect, disconnect and broadcast
 // actions.
-// The package implements simple peer-to-peer network node in pure Go. Uses
-// HTTP client and server to communicate over internet to knowed network
-// members. gop2p implements the following functional workflow:
+// The package implements simple peer-to-peer network node in pure Go. By
+// default, uses HTTP client and server to communicate over internet to knowed
+// network members, but any other transport.Transport can be provided. gop2p
+// implements the following functional workflow:
 //  1. Connect to the network: The client gop2p.Node know a entry point of the
 //     desired network (other gop2p.Node that is already connected). The entry
 //     point response with the current network gop2p.Node's and updates its
@@ -19,24 +20,29 @@ package node
 
 import (
 	"context"
-	"net/http"
+	"crypto/ecdh"
+	"crypto/ed25519"
 	"sync"
+	"time"
 
 	"github.com/lucasmenendez/gop2p/pkg/message"
 	"github.com/lucasmenendez/gop2p/pkg/peer"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
 )
 
 // Node struct contains the information about the current peer associated to
 // this node, the current network peers, some channels to errors, messages
 // (send/receive) and network (connect/leave) management. Also contains some
-// hidden parameters such as the http.Client associated to the node or a
-// WaitGroup to keep the node working.
+// hidden parameters such as the transport.Transport associated to the node or
+// a WaitGroup to keep the node working.
 type Node struct {
 	Self    *peer.Peer    // information about current node
 	Members *peer.Members // thread-safe list of peers on the network
 
-	Inbox chan *message.Message // readable channels to receive messages
-	Error chan *NodeErr         // readable channels to receive errors
+	Inbox   chan *message.Message // readable channels to receive messages
+	Error   chan *NodeErr         // readable channels to receive errors
+	Events  chan *Event           // readable channel to receive member changes
+	Streams chan *Stream          // readable channel to receive streams
 
 	Connection chan *peer.Peer       // writtable channel to connect to a Peer
 	Outbox     chan *message.Message // writtable channel to send messages
@@ -44,44 +50,119 @@ type Node struct {
 	connected bool
 	connMtx   *sync.Mutex
 
-	ctx    context.Context
-	cancel context.CancelFunc
-	client *http.Client
-	server *http.Server
-	waiter *sync.WaitGroup
+	key         ed25519.PrivateKey
+	encKey      *ecdh.PrivateKey
+	encDirect   bool
+	sessions    bool
+	swim        *swim
+	dedup       *dedupCache
+	gossip      *gossipConfig
+	pubsub      *pubsub
+	rpc         *rpc
+	inbox       *inbox
+	outbound    *outbound
+	streams     *streams
+	blobs       *blobs
+	chunkSize   int
+	maxBlobSize int
+	codecs      []message.Codec
+	workers     int
+	peerTimeout time.Duration
+	started     bool
+	ctx         context.Context
+	cancel      context.CancelFunc
+	transport   transport.Transport
+	waiter      *sync.WaitGroup
 }
 
-// New function create a Node associated to the peer provided as argument.
-func New(self *peer.Peer) *Node {
+// New function create a Node associated to the peer provided as argument. It
+// also accepts a list of options to customize the node, by default the node
+// uses a transport.HTTP to communicate with other peers.
+func New(self *peer.Peer, opts ...Option) *Node {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Node{
+	n := &Node{
 		Self:       self,
 		Members:    peer.NewMembers(),
 		Connection: make(chan *peer.Peer),
 		Inbox:      make(chan *message.Message),
 		Outbox:     make(chan *message.Message),
 		Error:      make(chan *NodeErr),
+		Events:     make(chan *Event, eventsBuffer),
+		Streams:    make(chan *Stream, streamsBuffer),
 
 		connected: false,
 		connMtx:   &sync.Mutex{},
 
-		ctx:    ctx,
-		cancel: cancel,
-		server: nil, // Initialize as nil to know if the the node is started
-		client: &http.Client{},
-		waiter: &sync.WaitGroup{},
+		key:         nil,
+		encKey:      nil,
+		encDirect:   false,
+		sessions:    false,
+		swim:        nil,
+		dedup:       newDedupCache(defaultDedupSize),
+		gossip:      nil,
+		pubsub:      newPubSub(),
+		rpc:         newRPC(),
+		inbox:       &inbox{policy: InboxBlock},
+		outbound:    newOutbound(defaultQueueSize),
+		streams:     newStreams(),
+		blobs:       newBlobs(),
+		chunkSize:   defaultChunkSize,
+		maxBlobSize: defaultMaxBlobSize,
+		codecs:      nil,
+		workers:     defaultWorkers,
+		peerTimeout: defaultPeerTimeout,
+		started:     false,
+		ctx:         ctx,
+		cancel:      cancel,
+		transport:   transport.NewHTTP(),
+		waiter:      &sync.WaitGroup{},
 	}
+
+	for _, opt := range opts {
+		opt(n)
+	}
+	// The codecs are negotiated by the resulting transport, if it supports
+	// it.
+	if negotiator, ok := n.transport.(transport.Negotiator); ok && len(n.codecs) > 0 {
+		negotiator.SetCodecs(n.codecs...)
+	}
+	// The messages relayed by the resulting transport, if it relays them,
+	// must pass the node checks.
+	if relayer, ok := n.transport.(transport.Relayer); ok {
+		relayer.SetRelayGuard(&transport.RelayGuard{
+			Member: func(p *peer.Peer) *peer.Peer { return n.Members.Get(p) },
+			Verify: n.verifySender,
+		})
+	}
+	// Secure sessions wrap the resulting transport, whatever option provides
+	// it.
+	if n.sessions {
+		n.transport = transport.NewSecure(n.transport, n.encKey)
+	}
+	return n
 }
 
-// Start function starts two goroutines, the first one to handle incoming
-// requests and the second one to handle user actions listening to defined
-// channels.
+// Start function starts to listen to incoming messages through the node
+// transport and starts a goroutine to handle user actions listening to defined
+// channels. If the transport fails listening, the error is sent to the
+// Node.Error channel.
 func (n *Node) Start() {
-	// Initialize the current node server
-	n.server = &http.Server{Addr: n.Self.String()}
+	// Start the transport to listen to other network peers messages.
+	if err := n.startListening(); err != nil {
+		go func() { n.Error <- err }()
+		return
+	}
+	n.started = true
 
-	// Start HTTP server to listen to other network peers requests.
-	go n.startListening()
+	// If the failure detection is enabled, start to probe the network members
+	// in background.
+	if n.swim != nil {
+		n.waiter.Add(1)
+		go func() {
+			defer n.waiter.Done()
+			n.detectFailures()
+		}()
+	}
 
 	// Increase the counter of the current node WaitGroup to wait for the
 	// following goroutine.
@@ -97,30 +178,22 @@ func (n *Node) Start() {
 				if connect {
 					// If the channel is still opened, try to connect to the peer
 					// provided.
-					if err := n.connect(p); err != nil {
+					if err := n.connect(n.ctx, p); err != nil {
 						n.Error <- err
 					}
 				} else {
 					// But if it was closed, disconnect from the network and
 					// reinitialize the channel.
-					if err := n.disconnect(); err != nil {
+					if err := n.disconnect(n.ctx); err != nil {
 						n.Error <- err
 					}
 					n.Connection = make(chan *peer.Peer)
 				}
 			case msg := <-n.Outbox:
-				var err *NodeErr
-				if msg.Type == message.DirectType {
-					// If the message is a direct message, send it to the
-					// intended peer.
-					err = n.send(msg)
-				} else if msg.Type == message.BroadcastType {
-					// Else if it is a broadcast message, broadcast it to the
-					// network
-					err = n.broadcast(msg)
-				}
-
-				if err != nil {
+				// Queue the direct message to the intended peers, or the
+				// broadcast message to every network member, without
+				// waiting for them to receive it.
+				if err := n.queue(msg); err != nil {
 					n.Error <- err
 				}
 			case <-n.ctx.Done():
@@ -140,35 +213,82 @@ func (n *Node) IsConnected() bool {
 	return n.connected
 }
 
+// Connect function connects the node to the network of the provided entry
+// point and returns the result, instead of sending it to the Node.Error
+// channel. It returns the context error if it is done before the node is
+// connected, stopping the connection to the rest of members and rolling it
+// back: the members joined are removed and the peers contacted are warned
+// about the disconnection in background.
+func (n *Node) Connect(ctx context.Context, entryPoint *peer.Peer) error {
+	return n.run(ctx, func(ctx context.Context) *NodeErr {
+		return n.connect(ctx, entryPoint)
+	})
+}
+
+// Disconnect function disconnects the node from the current network and
+// returns the result, instead of sending it to the Node.Error channel. It
+// returns the context error if it is done before the node is disconnected.
+func (n *Node) Disconnect(ctx context.Context) error {
+	return n.run(ctx, n.disconnect)
+}
+
+// Broadcast function sends the provided data to every network member and
+// returns the result, instead of sending it to the Node.Error channel. It
+// returns the context error if it is done before every member receives it,
+// without sending it to the rest of members.
+func (n *Node) Broadcast(ctx context.Context, data []byte) error {
+	msg := new(message.Message).SetFrom(n.Self).SetData(data)
+	return n.run(ctx, func(ctx context.Context) *NodeErr {
+		return n.broadcast(ctx, msg)
+	})
+}
+
+// Send function sends the provided data as a direct message to the provided
+// peers and returns the result, instead of sending it to the Node.Error
+// channel. It returns the context error if it is done before every peer
+// receives it, without sending it to the rest of peers.
+func (n *Node) Send(ctx context.Context, data []byte, to ...*peer.Peer) error {
+	if len(to) == 0 {
+		return InternalErr("no intended peer provided", nil)
+	}
+	msg := new(message.Message).SetFrom(n.Self).SetData(data).SetTo(to...)
+	return n.run(ctx, func(ctx context.Context) *NodeErr {
+		return n.send(ctx, msg)
+	})
+}
+
 // Stop function disconnect the node from the network, stop other goroutines
 // and close the node channels.
 func (n *Node) Stop() error {
 	// If the current node is not started return error
-	if n.server == nil {
+	if !n.started {
 		return InternalErr("current node not started", nil)
 	}
 
 	// If the node is connected, disconnect from the network
 	if n.IsConnected() {
-		if err := n.disconnect(); err != nil {
+		if err := n.disconnect(context.Background()); err != nil {
 			return err
 		}
 	}
 
-	// Shutdown the HTTP server
-	if err := n.server.Shutdown(n.ctx); err != nil {
-		return InternalErr("error shutting down the HTTP server", err)
+	// Abort the incoming streams to release the handlers waiting for them to
+	// be read, and close the transport to stop listening to other peers
+	n.closeStreams()
+	if err := n.transport.Close(); err != nil {
+		return InternalErr("error closing the transport", err)
 	}
 
 	// Cancel context that stops the start-loop and wait until finish
 	n.cancel()
 	n.waiter.Wait()
 
-	//  close the channels safely and assign nil to current server
+	//  close the channels safely and set the node as not started
+	n.closeSubscriptions()
 	safeClose(n.Inbox)
 	safeClose(n.Outbox)
 	safeClose(n.Connection)
 	safeClose(n.Error)
-	n.server = nil
+	n.started = false
 	return nil
 }
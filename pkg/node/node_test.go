@@ -1,6 +1,7 @@
 package node
 
 import (
+	"context"
 	"net/http"
 	"sync"
 	"testing"
@@ -8,7 +9,9 @@ import (
 
 	qt "github.com/frankban/quicktest"
 	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/nettest"
 	"github.com/lucasmenendez/gop2p/pkg/peer"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
 )
 
 func TestNodeStart(t *testing.T) {
@@ -101,6 +104,71 @@ func TestNodeIsConnected(t *testing.T) {
 	c.Assert(err, qt.IsNil)
 }
 
+func TestNodeMethods(t *testing.T) {
+	c := qt.New(t)
+
+	network := nettest.NewNetwork(1)
+	entryPoint := initMemoryNode(t, network, 5000)
+	client := initMemoryNode(t, network, 5001)
+	ctx := context.Background()
+
+	// Every method returns its own error
+	c.Assert(client.Broadcast(ctx, []byte("hello")), qt.ErrorMatches, ".*node not connected")
+	c.Assert(client.Send(ctx, []byte("hello")), qt.IsNotNil)
+	c.Assert(client.Disconnect(ctx), qt.IsNotNil)
+
+	c.Assert(client.Connect(ctx, entryPoint.Self), qt.IsNil)
+	c.Assert(client.IsConnected(), qt.IsTrue)
+	go func() {
+		c.Assert(client.Broadcast(ctx, []byte("broadcast")), qt.IsNil)
+	}()
+	received := <-entryPoint.Inbox
+	c.Assert(received.Type, qt.Equals, message.BroadcastType)
+	c.Assert(received.Data, qt.DeepEquals, []byte("broadcast"))
+	go func() {
+		c.Assert(client.Send(ctx, []byte("direct"), entryPoint.Self), qt.IsNil)
+	}()
+	received = <-entryPoint.Inbox
+	c.Assert(received.Type, qt.Equals, message.DirectType)
+	c.Assert(received.Data, qt.DeepEquals, []byte("direct"))
+
+	// The methods return when the context is done, stopping the action
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	c.Assert(client.Broadcast(canceled, []byte("hello")), qt.ErrorIs, context.Canceled)
+	network.SetLatency(50 * time.Millisecond)
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	c.Assert(client.Send(timeout, []byte("slow"), entryPoint.Self), qt.ErrorIs, context.DeadlineExceeded)
+	select {
+	case <-entryPoint.Inbox:
+		t.Fatal("cancelled message delivered")
+	case <-time.After(100 * time.Millisecond):
+	}
+	network.SetLatency(0)
+
+	c.Assert(client.Disconnect(ctx), qt.IsNil)
+	c.Assert(client.IsConnected(), qt.IsFalse)
+	c.Assert(entryPoint.Members.Len(), qt.Equals, 0)
+
+	// Cancelled connections are rolled back: the node does not change once
+	// the method returns and the members contacted forget it
+	other := initMemoryNode(t, network, 5002)
+	c.Assert(other.Connect(ctx, entryPoint.Self), qt.IsNil)
+	network.SetLatency(40 * time.Millisecond)
+	timeout, cancel = context.WithTimeout(ctx, 60*time.Millisecond)
+	defer cancel()
+	c.Assert(client.Connect(timeout, entryPoint.Self), qt.ErrorIs, context.DeadlineExceeded)
+	c.Assert(client.IsConnected(), qt.IsFalse)
+	c.Assert(client.Members.Len(), qt.Equals, 0)
+	for start := time.Now(); entryPoint.Members.Contains(client.Self) || other.Members.Contains(client.Self); {
+		c.Assert(time.Since(start) < 2*time.Second, qt.IsTrue, qt.Commentf("connection not rolled back"))
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(client.Members.Len(), qt.Equals, 0)
+	network.SetLatency(0)
+}
+
 func TestNodeStop(t *testing.T) {
 	c := qt.New(t)
 
@@ -131,3 +199,32 @@ func TestNodeStop(t *testing.T) {
 		c.Assert(err, qt.IsNotNil)
 	})
 }
+
+func TestNodeTCPTransport(t *testing.T) {
+	c := qt.New(t)
+
+	// Init and start two nodes using the TCP transport
+	first, _ := peer.Me(getRandomPort(), false)
+	firstNode := New(first, WithTransport(transport.NewTCP()))
+	firstNode.Start()
+	second, _ := peer.Me(getRandomPort(), false)
+	secondNode := New(second, WithTransport(transport.NewTCP()))
+	secondNode.Start()
+
+	// Connect the second node to the first one and broadcast a message
+	c.Assert(secondNode.connect(context.Background(), first), qt.DeepEquals, (*NodeErr)(nil))
+	c.Assert(firstNode.Members.Contains(second), qt.IsTrue)
+
+	data := []byte("test")
+	go func() {
+		msg := new(message.Message).SetFrom(second).SetData(data)
+		c.Assert(secondNode.broadcast(context.Background(), msg), qt.DeepEquals, (*NodeErr)(nil))
+	}()
+	msg := <-firstNode.Inbox
+	c.Assert(msg.Data, qt.DeepEquals, data)
+
+	// Stop both nodes
+	c.Assert(secondNode.Stop(), qt.IsNil)
+	c.Assert(firstNode.Members.Len(), qt.Equals, 0)
+	c.Assert(firstNode.Stop(), qt.IsNil)
+}
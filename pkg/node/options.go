@@ -0,0 +1,205 @@
+package node
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"time"
+
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
+)
+
+// Option function type allows to customize a Node during its creation. Any
+// number of options can be provided to the New function.
+type Option func(*Node)
+
+// WithTransport function returns an Option that sets the provided
+// transport.Transport as the carrier used by the node to communicate with other
+// peers, instead of the default HTTP transport.
+func WithTransport(t transport.Transport) Option {
+	return func(n *Node) {
+		n.transport = t
+	}
+}
+
+// WithTLS function returns an Option that sets a HTTP transport secured with
+// TLS using the provided configuration, that includes the server certificate,
+// the client certificate and the certificate pools to verify other peers. If
+// the configuration contains client CAs, the peers must authenticate each
+// other with mutual TLS.
+func WithTLS(config *transport.TLSConfig) Option {
+	return func(n *Node) {
+		n.transport = transport.NewHTTPS(config)
+	}
+}
+
+// WithKey function returns an Option that sets the provided private key as the
+// identity of the node. The public key associated is set to Node.Self, and the
+// node proves the possession of the private key during the connection
+// handshake. A node with identity rejects the connection of peers without it.
+func WithKey(key ed25519.PrivateKey) Option {
+	return func(n *Node) {
+		n.key = key
+		n.Self.PublicKey = key.Public().(ed25519.PublicKey)
+	}
+}
+
+// WithEncryption function returns an Option that enables the end-to-end
+// encryption of the direct messages using the provided X25519 private key.
+// The public key associated is set to Node.Self to allow to other peers to
+// encrypt messages for the node. The node encrypts the data of every direct
+// message sent for each intended peer, and decrypts the received ones before
+// delivering them to Node.Inbox. It should be combined with WithKey to
+// authenticate the encryption keys advertised by the peers.
+func WithEncryption(key *ecdh.PrivateKey) Option {
+	return func(n *Node) {
+		n.encKey = key
+		n.encDirect = true
+		n.Self.EncryptionKey = key.PublicKey().Bytes()
+	}
+}
+
+// WithSecureSessions function returns an Option that secures every
+// communication of the node with other peers establishing a session with each
+// of them through a Noise XX handshake, using the provided X25519 private key
+// as static key. Every message and response exchanged through the session is
+// encrypted and authenticated with ephemeral keys, providing forward secrecy.
+// The public key associated is set to Node.Self, and the peers must prove the
+// possession of the private key of the key that they advertise. Every peer of
+// the network must enable secure sessions. It can be combined with any other
+// transport option and with WithEncryption, using the same key.
+func WithSecureSessions(key *ecdh.PrivateKey) Option {
+	return func(n *Node) {
+		n.encKey = key
+		n.sessions = true
+		n.Self.EncryptionKey = key.PublicKey().Bytes()
+	}
+}
+
+// WithCodecs function returns an Option that sets the codecs that the node
+// accepts to encode the messages, sorted by preference, such as
+// message.CBORCodec. The transports that support it (transport.Negotiator),
+// such as the HTTP ones, negotiate the codec with every peer: the first
+// message is encoded as JSON and the next ones with the preferred codec that
+// the peer accepts, so peers with different codecs or versions can
+// communicate. By default, the messages are encoded as JSON.
+func WithCodecs(codecs ...message.Codec) Option {
+	return func(n *Node) {
+		n.codecs = codecs
+	}
+}
+
+// WithSWIM function returns an Option that enables the SWIM failure detection
+// with the provided configuration, or the default one if it is nil. The node
+// probes periodically the network members, directly and through other members,
+// suspecting the ones that do not respond and removing them from Node.Members
+// if they do not refute the suspicion. The membership updates are
+// disseminated piggybacked on the messages exchanged with other members, that
+// must enable it too.
+func WithSWIM(config *SWIMConfig) Option {
+	return func(n *Node) {
+		n.swim = newSWIM(config)
+	}
+}
+
+// WithMetadata function returns an Option that sets the provided metadata to
+// Node.Self, that is advertised to the other peers when the node connects to
+// the network. The peers can select the members by their metadata using
+// peer.Members.Select function.
+func WithMetadata(metadata map[string]string) Option {
+	return func(n *Node) {
+		n.Self.Metadata = metadata
+	}
+}
+
+// WithDedupCache function returns an Option that sets the number of message
+// IDs that the node remembers to discard the duplicated broadcast and direct
+// messages, instead of delivering them to Node.Inbox again. By default, the
+// node remembers the last 1024 IDs. A size lower or equal to zero disables the
+// duplicate suppression.
+func WithDedupCache(size int) Option {
+	return func(n *Node) {
+		n.dedup = nil
+		if size > 0 {
+			n.dedup = newDedupCache(size)
+		}
+	}
+}
+
+// WithGossip function returns an Option that makes the node disseminate its
+// broadcast messages epidemically instead of sending them to every member:
+// the message is sent to the provided number of random members, that forward
+// it to other random members until it reaches the provided number of hops.
+// Every member discards the copies already received. A fanout of zero uses
+// the default one (3) and a TTL of zero computes it from the network size.
+// A message can be gossiped without this option setting its TTL.
+func WithGossip(fanout, ttl int) Option {
+	return func(n *Node) {
+		n.gossip = &gossipConfig{fanout: fanout, ttl: ttl}
+	}
+}
+
+// WithInbox function returns an Option that bounds the Node.Inbox channel to
+// the provided size, and sets the policy applied when it is full: wait until
+// it has room (InboxBlock, by default), discard the oldest message
+// (InboxDropOldest), discard the received one (InboxDropNewest) or reject it
+// with a transport.ErrUnavailable error (InboxReject), that HTTP transports
+// report as a 503 status. The messages dropped and rejected are counted by
+// Node.InboxStats.
+func WithInbox(size int, policy InboxPolicy) Option {
+	return func(n *Node) {
+		if size < 0 {
+			size = 0
+		}
+		n.Inbox = make(chan *message.Message, size)
+		n.inbox.policy = policy
+	}
+}
+
+// WithQueueSize function returns an Option that sets the maximum number of
+// messages sent through Node.Outbox that can be queued for a single peer,
+// 1024 by default. The messages that exceed it are discarded, sending an
+// error to Node.Error.
+func WithQueueSize(size int) Option {
+	return func(n *Node) {
+		if size > 0 {
+			n.outbound.limit = size
+		}
+	}
+}
+
+// WithChunkSize function returns an Option that sets the size in bytes of the
+// chunks in which Node.SendStream splits the streams and Node.Put splits the
+// blobs, 64 KiB by default.
+func WithChunkSize(size int) Option {
+	return func(n *Node) {
+		if size > 0 {
+			n.chunkSize = size
+		}
+	}
+}
+
+// WithMaxBlobSize function returns an Option that sets the maximum size in
+// bytes of the blobs that Node.Get receives from other peers, 64 MiB by
+// default. The blobs announced with a larger size are not requested.
+func WithMaxBlobSize(size int) Option {
+	return func(n *Node) {
+		if size > 0 {
+			n.maxBlobSize = size
+		}
+	}
+}
+
+// WithFanout function returns an Option that sets the maximum number of peers
+// to which the node sends a message at the same time, and the time that it
+// waits for the acknowledgement of each one. By default, the node sends to 16
+// peers concurrently and waits up to 10 seconds for each one. A timeout of
+// zero waits without limit.
+func WithFanout(workers int, timeout time.Duration) Option {
+	return func(n *Node) {
+		if workers > 0 {
+			n.workers = workers
+		}
+		n.peerTimeout = timeout
+	}
+}
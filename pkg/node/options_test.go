@@ -0,0 +1,114 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/nettest"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
+)
+
+func TestWithTransport(t *testing.T) {
+	c := qt.New(t)
+
+	me, _ := peer.Me(getRandomPort(), false)
+	n := New(me)
+	_, isHTTP := n.transport.(*transport.HTTP)
+	c.Assert(isHTTP, qt.IsTrue)
+
+	memory := nettest.NewNetwork(1).Transport()
+	n = New(me, WithTransport(memory))
+	c.Assert(n.transport, qt.Equals, transport.Transport(memory))
+}
+
+func TestWithTLS(t *testing.T) {
+	c := qt.New(t)
+
+	me, _ := peer.Me(getRandomPort(), false)
+	n := New(me, WithTLS(&transport.TLSConfig{}))
+	_, isHTTP := n.transport.(*transport.HTTP)
+	c.Assert(isHTTP, qt.IsTrue)
+}
+
+func TestWithSecureSessions(t *testing.T) {
+	c := qt.New(t)
+
+	me, _ := peer.Me(getRandomPort(), false)
+	key, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	n := New(me, WithTLS(&transport.TLSConfig{}), WithSecureSessions(key))
+	_, isSecure := n.transport.(*transport.Secure)
+	c.Assert(isSecure, qt.IsTrue)
+	c.Assert(n.Self.EncryptionKey, qt.DeepEquals, key.PublicKey().Bytes())
+	c.Assert(n.encDirect, qt.IsFalse)
+}
+
+func TestWithCodecs(t *testing.T) {
+	c := qt.New(t)
+
+	newNode := func(codecs ...message.Codec) *Node {
+		me, _ := peer.Me(getRandomPort(), false)
+		n := New(me, WithCodecs(codecs...), WithInbox(2, InboxBlock))
+		n.Start()
+		t.Cleanup(func() { n.Stop() })
+		return n
+	}
+	cbor := newNode(message.CBORCodec)
+	other := newNode(message.CBORCodec)
+	legacy := newNode()
+	c.Assert(other.connect(context.Background(), cbor.Self), qt.DeepEquals, (*NodeErr)(nil))
+	c.Assert(legacy.connect(context.Background(), cbor.Self), qt.DeepEquals, (*NodeErr)(nil))
+
+	// Every node receives the messages, whatever codecs it accepts
+	data := bytes.Repeat([]byte{0xff}, 1024)
+	for _, sender := range []*Node{cbor, other, legacy} {
+		msg := new(message.Message).SetFrom(sender.Self).SetData(data)
+		c.Assert(sender.broadcast(context.Background(), msg), qt.DeepEquals, (*NodeErr)(nil))
+		for _, receiver := range []*Node{cbor, other, legacy} {
+			if receiver != sender {
+				c.Assert((<-receiver.Inbox).Data, qt.DeepEquals, data)
+			}
+		}
+	}
+}
+
+func TestWithSWIM(t *testing.T) {
+	c := qt.New(t)
+
+	me, _ := peer.Me(getRandomPort(), false)
+	c.Assert(New(me).swim, qt.IsNil)
+	n := New(me, WithSWIM(nil))
+	c.Assert(n.swim, qt.IsNotNil)
+	c.Assert(n.swim.config, qt.DeepEquals, DefaultSWIMConfig())
+}
+
+func TestWithMetadata(t *testing.T) {
+	c := qt.New(t)
+
+	network := nettest.NewNetwork(1)
+	entryPoint := initMemoryNode(t, network, 5000)
+	newNode := func(port int, role string) *Node {
+		p, _ := peer.New("localhost", port)
+		n := New(p, WithTransport(network.Transport()), WithMetadata(map[string]string{"role": role}))
+		n.Start()
+		return n
+	}
+	worker := newNode(5001, "worker")
+	storage := newNode(5002, "storage")
+	c.Assert(worker.connect(context.Background(), entryPoint.Self), qt.DeepEquals, (*NodeErr)(nil))
+	c.Assert(storage.connect(context.Background(), entryPoint.Self), qt.DeepEquals, (*NodeErr)(nil))
+
+	// The metadata is advertised to the entry point and to the other members
+	for _, n := range []*Node{entryPoint, worker} {
+		selected := n.Members.Select(func(p *peer.Peer) bool {
+			return p.Metadata["role"] == "storage"
+		})
+		c.Assert(selected, qt.HasLen, 1)
+		c.Assert(selected[0].Equal(storage.Self), qt.IsTrue)
+	}
+}
@@ -0,0 +1,173 @@
+package node
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+)
+
+// defaultQueueSize contains the default number of messages that can be queued
+// to be sent to a single peer.
+const defaultQueueSize = 1024
+
+// priorities contains the message priorities sorted by the order in which the
+// queued messages are sent.
+var priorities = []message.Priority{message.ControlPriority, message.DataPriority, message.BulkPriority}
+
+// peerQueue struct contains the messages queued to be sent to a peer, by
+// priority, and if there is a goroutine sending them.
+type peerQueue struct {
+	to      *peer.Peer
+	pending map[message.Priority][]*message.Message
+	size    int
+	sending bool
+}
+
+// pop function returns the next queued message to send, the oldest one with
+// the highest priority, or nil if there is no message queued.
+func (q *peerQueue) pop() *message.Message {
+	for _, priority := range priorities {
+		if msgs := q.pending[priority]; len(msgs) > 0 {
+			q.pending[priority] = msgs[1:]
+			q.size--
+			return msgs[0]
+		}
+	}
+	return nil
+}
+
+// outbound struct contains a queue of messages for every peer to which the
+// node is sending messages, and the maximum number of messages of each queue.
+type outbound struct {
+	queues map[string]*peerQueue
+	limit  int
+	mtx    *sync.Mutex
+}
+
+// newOutbound function creates an outbound without queues, that accepts up to
+// the provided number of messages for each peer.
+func newOutbound(limit int) *outbound {
+	return &outbound{queues: map[string]*peerQueue{}, limit: limit, mtx: &sync.Mutex{}}
+}
+
+// priority function returns the priority of the provided message. The
+// membership, failure detection and response messages are always control
+// messages.
+func priority(msg *message.Message) message.Priority {
+	switch msg.Type {
+	case message.ConnectType, message.DisconnectType, message.SubscribeType,
+		message.PingType, message.PingReqType, message.ResponseType:
+		return message.ControlPriority
+	default:
+		return msg.Priority
+	}
+}
+
+// enqueue function queues the provided message to be sent to the provided
+// peer, after the queued messages with the same or higher priority. Each peer
+// has its own queue, sent by its own goroutine, so a slow or unreachable peer
+// does not delay the messages to the rest. It returns an error if the queue of
+// the peer is full.
+func (n *Node) enqueue(to *peer.Peer, msg *message.Message) *NodeErr {
+	n.outbound.mtx.Lock()
+	defer n.outbound.mtx.Unlock()
+
+	q, exists := n.outbound.queues[to.String()]
+	if !exists {
+		q = &peerQueue{to: to, pending: map[message.Priority][]*message.Message{}}
+		n.outbound.queues[to.String()] = q
+	}
+	if q.size >= n.outbound.limit {
+		return ConnErr("error queueing the message", fmt.Errorf("%s: outbound queue full", to))
+	}
+	p := priority(msg)
+	q.pending[p] = append(q.pending[p], msg)
+	q.size++
+
+	if !q.sending {
+		q.sending = true
+		n.waiter.Add(1)
+		go func() {
+			defer n.waiter.Done()
+			n.drain(q)
+		}()
+	}
+	return nil
+}
+
+// drain function sends the messages queued for a peer until the queue is
+// empty or the node is stopped, sending the errors to the Node.Error channel.
+func (n *Node) drain(q *peerQueue) {
+	for {
+		n.outbound.mtx.Lock()
+		msg := q.pop()
+		if msg == nil || n.ctx.Err() != nil {
+			q.sending = false
+			delete(n.outbound.queues, q.to.String())
+			n.outbound.mtx.Unlock()
+			return
+		}
+		n.outbound.mtx.Unlock()
+
+		if err := n.sendQueued(q.to, msg); err != nil {
+			select {
+			case n.Error <- err:
+			case <-n.ctx.Done():
+			}
+		}
+	}
+}
+
+// sendQueued function sends the provided queued message to the provided peer,
+// encrypted for it if it is required, waiting up to the node per-peer timeout.
+func (n *Node) sendQueued(to *peer.Peer, msg *message.Message) *NodeErr {
+	toMsg, err := n.outgoing(msg, to)
+	if err != nil {
+		return err
+	}
+	if _, err := n.sendWithin(n.ctx, to, toMsg, n.peerTimeout); err != nil {
+		return ConnErr("error trying to perform the request", fmt.Errorf("%s: %w", to, err))
+	}
+	return nil
+}
+
+// queue function prepares the provided broadcast or direct message and queues
+// it to be sent to every intended peer, returning without waiting for them.
+// The broadcast messages gossiped are disseminated in background. The errors
+// of every peer are sent to the Node.Error channel.
+func (n *Node) queue(msg *message.Message) *NodeErr {
+	if !n.IsConnected() {
+		return ConnErr("node not connected", nil)
+	} else if msg.Type == message.DirectType && len(msg.To) == 0 {
+		return InternalErr("no intended peer defined at provided message", nil)
+	} else if msg.Type == message.BroadcastType && (msg.TTL > 0 || n.gossip != nil) {
+		n.waiter.Add(1)
+		go func() {
+			defer n.waiter.Done()
+			if err := n.disseminate(n.ctx, msg); err != nil {
+				select {
+				case n.Error <- err:
+				case <-n.ctx.Done():
+				}
+			}
+		}()
+		return nil
+	}
+
+	n.prepare(msg)
+	if msg.JSON() == nil {
+		return ParseErr("error encoding message to JSON", nil)
+	}
+	recipients := msg.To
+	if msg.Type == message.BroadcastType {
+		recipients = n.Members.Peers()
+	}
+	for _, to := range recipients {
+		if err := n.enqueue(to, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
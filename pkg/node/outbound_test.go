@@ -0,0 +1,92 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/nettest"
+)
+
+func Test_peerQueue(t *testing.T) {
+	c := qt.New(t)
+
+	q := &peerQueue{pending: map[message.Priority][]*message.Message{}}
+	push := func(data string, msgType int, p message.Priority) {
+		msg := new(message.Message).SetType(msgType).SetPriority(p)
+		msg.Data = []byte(data)
+		q.pending[priority(msg)] = append(q.pending[priority(msg)], msg)
+		q.size++
+	}
+	push("bulk", message.BroadcastType, message.BulkPriority)
+	push("data", message.BroadcastType, message.DataPriority)
+	push("disconnect", message.DisconnectType, message.BulkPriority)
+	push("control", message.DirectType, message.ControlPriority)
+	push("data 2", message.DirectType, message.DataPriority)
+
+	// Control messages first, then data and bulk ones, in order
+	for _, expected := range []string{"disconnect", "control", "data", "data 2", "bulk"} {
+		c.Assert(string(q.pop().Data), qt.Equals, expected)
+	}
+	c.Assert(q.pop(), qt.IsNil)
+	c.Assert(q.size, qt.Equals, 0)
+}
+
+func TestNodeOutbound(t *testing.T) {
+	c := qt.New(t)
+
+	network := nettest.NewNetwork(1)
+	sender := initMemoryNode(t, network, 5000)
+	fast := initMemoryNode(t, network, 5001)
+	slow := initMemoryNode(t, network, 5002)
+	c.Assert(fast.connect(context.Background(), sender.Self), qt.DeepEquals, (*NodeErr)(nil))
+	c.Assert(slow.connect(context.Background(), sender.Self), qt.DeepEquals, (*NodeErr)(nil))
+	queued := func() int {
+		sender.outbound.mtx.Lock()
+		defer sender.outbound.mtx.Unlock()
+		if q, ok := sender.outbound.queues[slow.Self.String()]; ok {
+			return q.size
+		}
+		return -1
+	}
+
+	// A message to the slow peer keeps waiting until it reads it
+	sender.Outbox <- new(message.Message).SetFrom(sender.Self).SetData([]byte("first")).SetTo(slow.Self)
+	c.Assert(waitFor(func() bool { return queued() == 0 }), qt.IsTrue)
+
+	// The messages to other peers are not delayed by the slow one
+	sender.Outbox <- new(message.Message).SetFrom(sender.Self).SetData([]byte("bulk")).SetPriority(message.BulkPriority)
+	sender.Outbox <- new(message.Message).SetFrom(sender.Self).SetData([]byte("data"))
+	sender.Outbox <- new(message.Message).SetFrom(sender.Self).SetData([]byte("urgent")).SetPriority(message.ControlPriority)
+	received := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		select {
+		case msg := <-fast.Inbox:
+			received[string(msg.Data)] = true
+		case <-time.After(time.Second):
+			t.Fatal("message delayed by other peer")
+		}
+	}
+	c.Assert(received, qt.DeepEquals, map[string]bool{"bulk": true, "data": true, "urgent": true})
+
+	// The messages queued for the slow peer are sent by priority
+	c.Assert(waitFor(func() bool { return queued() == 3 }), qt.IsTrue)
+	for _, expected := range []string{"first", "urgent", "data", "bulk"} {
+		c.Assert(string((<-slow.Inbox).Data), qt.Equals, expected)
+	}
+
+	// The messages that exceed the queue size are discarded
+	WithQueueSize(1)(sender)
+	c.Assert(waitFor(func() bool { return queued() == -1 }), qt.IsTrue)
+	sender.Outbox <- new(message.Message).SetFrom(sender.Self).SetData([]byte("first")).SetTo(slow.Self)
+	c.Assert(waitFor(func() bool { return queued() == 0 }), qt.IsTrue)
+	sender.Outbox <- new(message.Message).SetFrom(sender.Self).SetData([]byte("second")).SetTo(slow.Self)
+	sender.Outbox <- new(message.Message).SetFrom(sender.Self).SetData([]byte("third")).SetTo(slow.Self)
+	err := <-sender.Error
+	c.Assert(err.ErrCode, qt.Equals, CONNECTION_ERR)
+	c.Assert(err, qt.ErrorMatches, ".*outbound queue full")
+	c.Assert(string((<-slow.Inbox).Data), qt.Equals, "first")
+	c.Assert(string((<-slow.Inbox).Data), qt.Equals, "second")
+}
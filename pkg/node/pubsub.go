@@ -0,0 +1,276 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
+)
+
+// topicBuffer contains the number of messages that every topic channel keeps
+// until they are read.
+const topicBuffer = 64
+
+// subscription struct contains the channel where the messages published to a
+// topic are delivered. The channel is closed when the node unsubscribes from
+// the topic, once the pending deliveries are cancelled.
+type subscription struct {
+	ch   chan *message.Message
+	done chan struct{}
+	mtx  *sync.RWMutex
+}
+
+// deliver function sends the provided message to the subscription channel,
+// waiting until it is read or the subscription is cancelled.
+func (s *subscription) deliver(msg *message.Message) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	select {
+	case <-s.done:
+		// The channel could be already closed.
+		return
+	default:
+	}
+	select {
+	case <-s.done:
+	case s.ch <- msg:
+	}
+}
+
+// cancel function cancels the pending deliveries and closes the subscription
+// channel.
+func (s *subscription) cancel() {
+	close(s.done)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	close(s.ch)
+}
+
+// pubsub struct contains the topics to which the node is subscribed and the
+// topics to which every network member is subscribed, by its address.
+type pubsub struct {
+	topics map[string]*subscription
+	peers  map[string][]string
+	mtx    *sync.Mutex
+}
+
+// newPubSub function creates an empty pubsub.
+func newPubSub() *pubsub {
+	return &pubsub{
+		topics: map[string]*subscription{},
+		peers:  map[string][]string{},
+		mtx:    &sync.Mutex{},
+	}
+}
+
+// local function returns the sorted topics to which the node is subscribed.
+func (ps *pubsub) local() []string {
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+	topics := []string{}
+	for topic := range ps.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// subscription function returns the subscription of the node to the provided
+// topic, or nil if it is not subscribed.
+func (ps *pubsub) subscription(topic string) *subscription {
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+	return ps.topics[topic]
+}
+
+// set function replaces the topics to which the provided peer is subscribed.
+func (ps *pubsub) set(p *peer.Peer, topics []string) {
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+	if len(topics) == 0 {
+		delete(ps.peers, p.String())
+		return
+	}
+	ps.peers[p.String()] = topics
+}
+
+// forget function forgets the topics to which the provided peer is
+// subscribed, so other peer that joins later with the same address does not
+// inherit them.
+func (ps *pubsub) forget(p *peer.Peer) {
+	ps.set(p, nil)
+}
+
+// subscribed function returns if the provided peer is subscribed to the
+// provided topic.
+func (ps *pubsub) subscribed(p *peer.Peer, topic string) bool {
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+	for _, t := range ps.peers[p.String()] {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribe function subscribes the node to the provided topic and returns the
+// channel where the messages published to it by other peers are delivered.
+// The subscription is announced to the current network members, and to the
+// members that the node meets when it connects to a network. If the node is
+// already subscribed to the topic, it returns the same channel.
+func (n *Node) Subscribe(topic string) (<-chan *message.Message, error) {
+	if topic == "" {
+		return nil, InternalErr("no topic provided", nil)
+	}
+
+	n.pubsub.mtx.Lock()
+	sub, exists := n.pubsub.topics[topic]
+	if !exists {
+		sub = &subscription{
+			ch:   make(chan *message.Message, topicBuffer),
+			done: make(chan struct{}),
+			mtx:  &sync.RWMutex{},
+		}
+		n.pubsub.topics[topic] = sub
+	}
+	n.pubsub.mtx.Unlock()
+
+	if !exists && n.IsConnected() {
+		n.announce(n.Members.Peers())
+	}
+	return sub.ch, nil
+}
+
+// Unsubscribe function unsubscribes the node from the provided topic, closing
+// its channel, and announces it to the current network members. It returns an
+// error if the node is not subscribed to the topic.
+func (n *Node) Unsubscribe(topic string) error {
+	n.pubsub.mtx.Lock()
+	sub, exists := n.pubsub.topics[topic]
+	delete(n.pubsub.topics, topic)
+	n.pubsub.mtx.Unlock()
+	if !exists {
+		return InternalErr("node not subscribed to the topic", nil)
+	}
+
+	sub.cancel()
+	if n.IsConnected() {
+		n.announce(n.Members.Peers())
+	}
+	return nil
+}
+
+// Subscribers function returns the network members subscribed to the provided
+// topic.
+func (n *Node) Subscribers(topic string) []*peer.Peer {
+	return n.Members.Select(func(p *peer.Peer) bool {
+		return n.pubsub.subscribed(p, topic)
+	})
+}
+
+// Publish function sends the provided data to the network members subscribed
+// to the provided topic, that receive it through the channel of their
+// subscription instead of Node.Inbox. It returns an error that collects the
+// errors of every subscriber that does not receive it.
+func (n *Node) Publish(topic string, data []byte) error {
+	if !n.IsConnected() {
+		return ConnErr("node not connected", nil)
+	} else if topic == "" {
+		return InternalErr("no topic provided", nil)
+	}
+
+	msg := new(message.Message).SetType(message.PublishType).SetFrom(n.Self)
+	msg.Data, msg.Topic = data, topic
+	n.prepare(msg)
+	if msg.JSON() == nil {
+		return ParseErr("error encoding message to JSON", nil)
+	}
+	errs := []error{}
+	for _, delivery := range n.fanout(n.ctx, msg, n.Subscribers(topic), &RetryPolicy{Attempts: 1}) {
+		if delivery.Status != Delivered {
+			errs = append(errs, fmt.Errorf("%s: %w", delivery.Peer, delivery.Err))
+		}
+	}
+	if len(errs) > 0 {
+		return ConnErr("error trying to perform the request", errors.Join(errs...))
+	}
+	return nil
+}
+
+// announce function sends the topics to which the node is subscribed to the
+// provided peers, and updates the topics to which they are subscribed with
+// their responses. The peers that do not support topics are ignored.
+func (n *Node) announce(peers []*peer.Peer) {
+	data, _ := json.Marshal(n.pubsub.local())
+	msg := new(message.Message).SetType(message.SubscribeType).SetFrom(n.Self)
+	msg.Data = data
+	n.prepare(msg)
+
+	wg := &sync.WaitGroup{}
+	for _, p := range peers {
+		wg.Add(1)
+		go func(p *peer.Peer) {
+			defer wg.Done()
+			if res, err := n.sendWithin(n.ctx, p, msg, n.peerTimeout); err == nil {
+				topics := []string{}
+				if err := json.Unmarshal(res, &topics); err == nil {
+					n.pubsub.set(p, topics)
+				}
+			}
+		}(p)
+	}
+	wg.Wait()
+}
+
+// handleSubscribe function updates the topics to which the sender of the
+// provided message is subscribed, and responds with the topics to which the
+// node is subscribed.
+func (n *Node) handleSubscribe(msg *message.Message) ([]byte, error) {
+	if err := n.verifySender(msg); err != nil {
+		return nil, err
+	}
+	n.applyUpdates(msg.Updates)
+
+	topics := []string{}
+	if err := json.Unmarshal(msg.Data, &topics); err != nil {
+		return nil, fmt.Errorf("%w: %v", transport.ErrBadMessage, err)
+	}
+	n.pubsub.set(msg.From, topics)
+	return json.Marshal(n.pubsub.local())
+}
+
+// handlePublish function delivers the provided message to the channel of the
+// subscription to its topic, if the node is subscribed to it. The messages
+// published to other topics are discarded.
+func (n *Node) handlePublish(msg *message.Message) ([]byte, error) {
+	if err := n.verifySender(msg); err != nil {
+		return nil, err
+	}
+	n.applyUpdates(msg.Updates)
+	if n.duplicated(msg) {
+		return nil, nil
+	}
+
+	if sub := n.pubsub.subscription(msg.Topic); sub != nil {
+		sub.deliver(msg)
+	}
+	return nil, nil
+}
+
+// closeSubscriptions function unsubscribes the node from every topic, closing
+// their channels, without announcing it.
+func (n *Node) closeSubscriptions() {
+	n.pubsub.mtx.Lock()
+	topics := n.pubsub.topics
+	n.pubsub.topics = map[string]*subscription{}
+	n.pubsub.mtx.Unlock()
+	for _, sub := range topics {
+		sub.cancel()
+	}
+}
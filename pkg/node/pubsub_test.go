@@ -0,0 +1,71 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/nettest"
+)
+
+func TestNodePubSub(t *testing.T) {
+	c := qt.New(t)
+
+	network := nettest.NewNetwork(1)
+	publisher := initMemoryNode(t, network, 5000)
+	subscriber := initMemoryNode(t, network, 5001)
+	other := initMemoryNode(t, network, 5002)
+
+	_, err := subscriber.Subscribe("")
+	c.Assert(err, qt.IsNotNil)
+	nodeErr := new(NodeErr)
+	c.Assert(errors.As(publisher.Publish("jobs", []byte("job")), &nodeErr), qt.IsTrue)
+	c.Assert(nodeErr.ErrCode, qt.Equals, CONNECTION_ERR)
+
+	// The subscriptions made before connecting are announced when the node
+	// connects, and the ones made after it are announced to the members
+	jobs, err := subscriber.Subscribe("jobs")
+	c.Assert(err, qt.IsNil)
+	again, _ := subscriber.Subscribe("jobs")
+	c.Assert(again, qt.Equals, jobs)
+	c.Assert(subscriber.connect(context.Background(), publisher.Self), qt.DeepEquals, (*NodeErr)(nil))
+	c.Assert(other.connect(context.Background(), publisher.Self), qt.DeepEquals, (*NodeErr)(nil))
+	logs, _ := other.Subscribe("logs")
+	c.Assert(publisher.Subscribers("jobs"), qt.HasLen, 1)
+	c.Assert(publisher.Subscribers("jobs")[0].Equal(subscriber.Self), qt.IsTrue)
+	c.Assert(other.Subscribers("jobs"), qt.HasLen, 1)
+	c.Assert(subscriber.Subscribers("logs"), qt.HasLen, 1)
+
+	// The published messages only reach the subscribers of the topic, through
+	// the topic channel instead of the inbox
+	c.Assert(publisher.Publish("jobs", []byte("job")), qt.IsNil)
+	received := <-jobs
+	c.Assert(received.Type, qt.Equals, message.PublishType)
+	c.Assert(received.Topic, qt.Equals, "jobs")
+	c.Assert(received.Data, qt.DeepEquals, []byte("job"))
+	c.Assert(publisher.Publish("logs", []byte("log")), qt.IsNil)
+	c.Assert((<-logs).Data, qt.DeepEquals, []byte("log"))
+	c.Assert(publisher.Publish("none", []byte("none")), qt.IsNil)
+	select {
+	case <-jobs:
+		t.Fatal("message of other topic received")
+	case <-subscriber.Inbox:
+		t.Fatal("published message received through the inbox")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Unsubscribing closes the topic channel and it is announced
+	c.Assert(subscriber.Unsubscribe("jobs"), qt.IsNil)
+	_, open := <-jobs
+	c.Assert(open, qt.IsFalse)
+	c.Assert(publisher.Subscribers("jobs"), qt.HasLen, 0)
+	c.Assert(subscriber.Unsubscribe("jobs"), qt.IsNotNil)
+
+	// The subscriptions of the peers that leave are forgotten
+	c.Assert(publisher.pubsub.subscribed(other.Self, "logs"), qt.IsTrue)
+	c.Assert(other.disconnect(context.Background()), qt.DeepEquals, (*NodeErr)(nil))
+	c.Assert(publisher.pubsub.subscribed(other.Self, "logs"), qt.IsFalse)
+}
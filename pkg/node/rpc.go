@@ -0,0 +1,154 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
+)
+
+// RequestHandler function type handles the requests received by a node from
+// other peers, returning the data of the response, or an error that is
+// returned to the requester.
+type RequestHandler func(msg *message.Message) ([]byte, error)
+
+// rpc struct contains the handler of the requests received by the node and
+// the services registered by name.
+type rpc struct {
+	handler  RequestHandler
+	services map[string]ServiceHandler
+	mtx      *sync.Mutex
+}
+
+// newRPC function creates a rpc without handler nor services.
+func newRPC() *rpc {
+	return &rpc{handler: nil, services: map[string]ServiceHandler{}, mtx: &sync.Mutex{}}
+}
+
+// HandleRequests function registers the provided handler to respond to the
+// requests received from other peers, replacing the previous one. If no
+// handler is registered, the requests are rejected.
+func (n *Node) HandleRequests(handler RequestHandler) {
+	n.rpc.mtx.Lock()
+	defer n.rpc.mtx.Unlock()
+	n.rpc.handler = handler
+}
+
+// Request function sends the provided data as a request to the provided peer
+// and waits for its response, returning the data of the response. The request
+// is identified by its ID, and the response must refer to it. It waits until
+// the provided context is done or, if it has no deadline, up to the node
+// per-peer timeout. If the peer fails handling the request, it returns a
+// remote error with the error returned by the peer handler.
+func (n *Node) Request(ctx context.Context, to *peer.Peer, data []byte) ([]byte, error) {
+	msg := new(message.Message).SetType(message.RequestType).SetFrom(n.Self)
+	msg.Data = data
+	return n.roundTrip(ctx, to, msg)
+}
+
+// roundTrip function sends the provided request message to the provided peer
+// and waits for its response, returning its data. It waits until the provided
+// context is done or, if it has no deadline, up to the node per-peer timeout.
+func (n *Node) roundTrip(ctx context.Context, to *peer.Peer, msg *message.Message) ([]byte, error) {
+	if !n.IsConnected() {
+		return nil, ConnErr("node not connected", nil)
+	}
+
+	msg.To = []*peer.Peer{to}
+	n.prepare(msg)
+	if msg.JSON() == nil {
+		return nil, ParseErr("error encoding message to JSON", nil)
+	}
+	reqMsg, nerr := n.outgoing(msg, to)
+	if nerr != nil {
+		return nil, nerr
+	}
+
+	if _, ok := ctx.Deadline(); !ok && n.peerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.peerTimeout)
+		defer cancel()
+	}
+	res, err := n.sendContext(ctx, to, reqMsg)
+	if err != nil {
+		return nil, ConnErr("error trying to perform the request", err)
+	}
+	return n.reply(msg, res)
+}
+
+// reply function decodes and checks the response to the provided request,
+// returning its data or the error returned by the peer.
+func (n *Node) reply(req *message.Message, res []byte) ([]byte, error) {
+	msg := new(message.Message).SetJSON(res)
+	if msg == nil || msg.From == nil || msg.Type != message.ResponseType {
+		return nil, ParseErr("error decoding the response", nil)
+	} else if msg.ReplyTo != req.ID {
+		return nil, ParseErr("the response does not refer to the request", nil)
+	} else if err := n.verifySender(msg); err != nil {
+		return nil, ConnErr("error verifying the response", err)
+	} else if err := n.decrypt(msg); err != nil {
+		return nil, ParseErr("error decrypting the response", err)
+	}
+
+	n.applyUpdates(msg.Updates)
+	if msg.Error != "" {
+		return nil, RemoteErr("error handling the request", errors.New(msg.Error))
+	}
+	return msg.Data, nil
+}
+
+// sendContext function sends the provided message to the provided peer through
+// the node transport and returns its response, or the context error if it is
+// not received before the provided context is done, that the transport stops
+// at.
+func (n *Node) sendContext(ctx context.Context, to *peer.Peer, msg *message.Message) ([]byte, error) {
+	res, err := n.transport.Send(ctx, to, msg)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return res, err
+}
+
+// handleRequest function handles the requests received, passing them to the
+// registered handler and responding with a response message that refers to
+// the request and contains the data returned by the handler or its error.
+func (n *Node) handleRequest(msg *message.Message) ([]byte, error) {
+	n.rpc.mtx.Lock()
+	handler := n.rpc.handler
+	n.rpc.mtx.Unlock()
+	if handler == nil {
+		return nil, fmt.Errorf("%w: no request handler registered", transport.ErrNotAllowed)
+	} else if err := n.verifySender(msg); err != nil {
+		return nil, err
+	} else if err := n.decrypt(msg); err != nil {
+		return nil, err
+	}
+	n.applyUpdates(msg.Updates)
+
+	data, err := handler(msg)
+	return n.respond(msg, data, err)
+}
+
+// respond function returns the encoded response to the provided request, that
+// contains the provided data or, if the request fails, the provided error. The
+// response is encrypted for the requester if the node has direct message
+// encryption enabled.
+func (n *Node) respond(req *message.Message, data []byte, reqErr error) ([]byte, error) {
+	res := new(message.Message).SetType(message.ResponseType).SetFrom(n.Self)
+	res.To, res.ReplyTo = []*peer.Peer{req.From}, req.ID
+	if reqErr != nil {
+		res.Error = reqErr.Error()
+	} else {
+		res.Data = data
+	}
+	n.prepare(res)
+	resMsg, err := n.outgoing(res, req.From)
+	if err != nil {
+		return nil, err
+	}
+	return resMsg.JSON(), nil
+}
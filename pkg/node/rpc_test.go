@@ -0,0 +1,93 @@
+package node
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/nettest"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
+)
+
+func TestNodeRequest(t *testing.T) {
+	c := qt.New(t)
+
+	network := nettest.NewNetwork(1)
+	client := initMemoryNode(t, network, 5000)
+	server := initMemoryNode(t, network, 5001)
+	ctx := context.Background()
+
+	_, err := client.Request(ctx, server.Self, []byte("ping"))
+	c.Assert(err, qt.ErrorAs, new(*NodeErr))
+	c.Assert(err.(*NodeErr).ErrCode, qt.Equals, CONNECTION_ERR)
+	c.Assert(client.connect(context.Background(), server.Self), qt.DeepEquals, (*NodeErr)(nil))
+
+	// Requests are rejected without handler
+	_, err = client.Request(ctx, server.Self, []byte("ping"))
+	c.Assert(errors.Is(err, transport.ErrNotAllowed), qt.IsTrue)
+
+	// The handler response is returned to the requester
+	server.HandleRequests(func(msg *message.Message) ([]byte, error) {
+		if string(msg.Data) == "fail" {
+			return nil, fmt.Errorf("request failed")
+		}
+		return append([]byte("re: "), msg.Data...), nil
+	})
+	res, err := client.Request(ctx, server.Self, []byte("ping"))
+	c.Assert(err, qt.IsNil)
+	c.Assert(res, qt.DeepEquals, []byte("re: ping"))
+
+	// The handler errors are returned as remote errors
+	_, err = client.Request(ctx, server.Self, []byte("fail"))
+	c.Assert(err, qt.ErrorAs, new(*NodeErr))
+	c.Assert(err.(*NodeErr).ErrCode, qt.Equals, REMOTE_ERR)
+	c.Assert(err, qt.ErrorMatches, ".*request failed")
+
+	// Requests to peers out of the network are not sent
+	unknown, _ := peer.New("localhost", 5002)
+	_, err = client.Request(ctx, unknown, []byte("ping"))
+	c.Assert(err, qt.IsNotNil)
+
+	// Requests time out when the context is done
+	network.SetLatency(50 * time.Millisecond)
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = client.Request(timeout, server.Self, []byte("ping"))
+	c.Assert(errors.Is(err, context.DeadlineExceeded), qt.IsTrue)
+	network.SetLatency(0)
+}
+
+func TestNodeRequestEncrypted(t *testing.T) {
+	c := qt.New(t)
+
+	network := nettest.NewNetwork(1)
+	nodes := []*Node{}
+	for port := 5000; port < 5002; port++ {
+		p, err := peer.New("localhost", port)
+		c.Assert(err, qt.IsNil)
+		_, key, _ := ed25519.GenerateKey(nil)
+		encKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+		n := New(p, WithTransport(network.Transport()), WithKey(key), WithEncryption(encKey))
+		n.Start()
+		nodes = append(nodes, n)
+	}
+	client, server := nodes[0], nodes[1]
+	c.Assert(client.connect(context.Background(), server.Self), qt.DeepEquals, (*NodeErr)(nil))
+
+	// Both the request and the response are encrypted
+	server.HandleRequests(func(msg *message.Message) ([]byte, error) {
+		c.Assert(msg.Encrypted, qt.IsFalse)
+		return msg.Data, nil
+	})
+	res, err := client.Request(context.Background(), server.Self, []byte("secret"))
+	c.Assert(err, qt.IsNil)
+	c.Assert(res, qt.DeepEquals, []byte("secret"))
+}
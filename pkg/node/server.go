@@ -1,134 +1,172 @@
 package node
 
 import (
-	"io"
-	"net/http"
+	"fmt"
 
 	"github.com/lucasmenendez/gop2p/pkg/message"
 	"github.com/lucasmenendez/gop2p/pkg/peer"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
 )
 
-// startListening function creates a HTTP request multiplexer to assing the root
-// path to the Node.handleRequest function, assign it to the current Node.server
-// and tries to start the HTTP server.
-func (n *Node) startListening() {
-	mux := http.NewServeMux()
-	// Listen on root every request and handle it with the default node handler.
-	mux.HandleFunc("/", n.handleRequest())
-
-	// Create the node HTTP server to listen to other peers requests.
-	n.server.Handler = mux
-
-	// If some error occurs it will be writted into Error channel and try to
-	// disconnect.
-	err := n.server.ListenAndServe()
-
-	// If something was wrong, except the server is cosed, handle the error.
-	if err != nil {
-		// If the current node was connected, update status to disconnected and
-		// close the channel.
+// startListening function starts the current node transport to listen to
+// other network peers messages, assigning Node.handleMessage function as
+// handler. If something fails, returns an error.
+func (n *Node) startListening() *NodeErr {
+	if err := n.transport.Listen(n.Self, n.handleMessage); err != nil {
+		// If the current node was connected, update status to disconnected.
 		if n.IsConnected() {
 			n.Members = peer.NewMembers()
 			n.setConnected(false)
 		}
 
-		n.Error <- InternalErr("error listening for HTTP requests", err)
+		return InternalErr("error listening for incoming messages", err)
 	}
+	return nil
 }
 
-// handleRequest function manages every request received by the current network
-// and performs the correct acttion to this requests. The function selects the
-// correct handler based on the parsed message from the request. The connection
-// message will come from "GET" requests, the disconnection message from
-// "DELETE" requests and the plain message from "POST" requests.
-func (n *Node) handleRequest() func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Host == n.Self.String() {
-			http.Error(w, "You can not connect with yourself.", http.StatusBadRequest)
-			return
-		}
+// handleMessage function manages every message received by the current node
+// transport and performs the correct action to this messages. The function
+// selects the correct handler based on the message type. The connection
+// message will be responded with the current network members, the
+// disconnection message will unregister the sender, the plain and direct
+// messages will be delivered to the Node.Inbox channel, the gossip messages
+// will be delivered and forwarded to other members and the ping messages will
+// be acknowledged. The topics announced are registered, and the messages
+// published to topics are delivered to the subscription channels. The
+// requests are responded by the registered request handler, and the calls by
+// the registered services. The membership updates piggybacked are applied. It
+// returns an error defined by transport package if the message is rejected.
+func (n *Node) handleMessage(msg *message.Message) ([]byte, error) {
+	if msg.From == nil {
+		return nil, transport.ErrBadMessage
+	} else if msg.From.Equal(n.Self) {
+		return nil, fmt.Errorf("%w: you can not connect with yourself", transport.ErrBadMessage)
+	}
 
-		// Set cors compatible headers when the request has OPTION method.
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "*")
-		if r.Method == http.MethodOptions {
-			http.Error(w, "No Content", http.StatusNoContent)
-			return
+	switch msg.Type {
+	case message.ConnectType:
+		// Handle a new connection to the network, appending the peer of the
+		// message to the current network members and response with that
+		// list encoding to JSON.
+
+		// If the peer provides a public key, it must prove the possession of
+		// the private key. If the current node has identity, the peers must
+		// have it too.
+		if msg.From.PublicKey != nil {
+			if err := verifyConnectProof(msg); err != nil {
+				return nil, fmt.Errorf("%w: %v", transport.ErrForbidden, err)
+			} else if err := n.verifySender(msg); err != nil {
+				return nil, err
+			}
+		} else if n.key != nil {
+			return nil, fmt.Errorf("%w: peer identity required", transport.ErrForbidden)
+		}
+		// Relayed peers can not take the place of the members reachable
+		// directly.
+		if msg.From.Relay != nil {
+			if member := n.Members.Get(msg.From); member != nil && member.Relay == nil {
+				return nil, fmt.Errorf("%w: peer already connected directly", transport.ErrForbidden)
+			}
 		}
 
-		// Parse request to a message
-		data, err := io.ReadAll(r.Body)
+		// Encode current list of members to a JSON to send it
+		responseBody, err := n.Members.ToJSON()
 		if err != nil {
-			http.Error(w, "no valid message provided", http.StatusBadRequest)
-			return
+			errMsg := "error encoding members to JSON"
+			n.Error <- ParseErr(errMsg, err)
+			return nil, fmt.Errorf("%s: %w", errMsg, err)
 		}
 
-		msg := new(message.Message).SetJSON(data)
-		if msg == nil {
-			// If something fails decoding message from the request, response
-			// with a bad request HTTP error.
-			http.Error(w, "No valid Message provided", http.StatusBadRequest)
-			return
+		// Update the current member list safely appending the Message.From
+		// Peer, or replacing it if it connects again, and if the current node
+		// was not connected update its status. The pending updates about the
+		// peer are outdated, because it joins again.
+		n.rejoin(msg.From, "connected")
+		n.setConnected(true)
+		if n.swim != nil {
+			n.swim.forget(msg.From)
+		}
+		n.applyUpdates(msg.Updates)
+
+		// Send the current member list JSON to the connected peer
+		return responseBody, nil
+	case message.BroadcastType, message.DirectType:
+		if err := n.verifySender(msg); err != nil {
+			// If the message peer is not a registered member of the current
+			// network or the message signature is not valid, return a
+			// forbidden error.
+			return nil, err
+		} else if err := n.decrypt(msg); err != nil {
+			// If the message is encrypted and can not be decrypted, return a
+			// bad message error.
+			return nil, err
+		}
+		n.applyUpdates(msg.Updates)
+		if n.duplicated(msg) {
+			// If the message has been already received, for example, because
+			// the sender retries it, acknowledge it without delivering it
+			// again.
+			return nil, nil
+		}
+		// When broadcast or direct message is received it will be redirected
+		// to the inbox messages channel where the user will be waiting for
+		// read it.
+		if err := n.push(msg); err != nil {
+			// If the inbox rejects the message, forget it to deliver it
+			// when the sender retries it.
+			n.undeliver(msg)
+			return nil, err
+		}
+	case message.DisconnectType:
+		if err := n.verifySender(msg); err != nil {
+			// If the message peer is not a registered member of the current
+			// network or the message signature is not valid, return a
+			// forbidden error.
+			return nil, err
 		}
 
-		// Select the handler based on the current request http.Method, GET
-		// method is for connection requests, POST method for the plain message
-		// request and  DELETE method for the disconnection requests. Otherwise
-		// response with 405 HTTP Status Code.
-		switch msg.Type {
-		case message.ConnectType:
-			// Handle a new connection to the network, appending the peer of the
-			// request to the current network members and response with that
-			// list encoding to JSON.
-
-			// Encode current list of members to a JSON to send it
-			responseBody, err := n.Members.ToJSON()
-			if err != nil {
-				errMsg := "error encoding members to JSON"
-				n.Error <- ParseErr(errMsg, err)
-				http.Error(w, errMsg, http.StatusInternalServerError)
-				return
-			}
-
-			// Update the current member list safely appending the Message.From
-			// Peer and if the current node was not connected update its status.
-			n.Members.Append(msg.From)
-			n.setConnected(true)
-
-			// Send the current member list JSON to the connected peer
-			w.Header().Set("Content-Type", "text/plain")
-			w.Write(responseBody)
-		case message.BroadcastType, message.DirectType:
-			if !n.Members.Contains(msg.From) {
-				// If the message peer is not a registered member of the current
-				// network, return a forbidden HTTP error.
-				http.Error(w, "Peer not registered", http.StatusForbidden)
-				return
-			}
-			// When broadcast or direct message is received it will be redirected
-			// to the inbox messages channel where the user will be waiting for
-			// read it.
-			n.Inbox <- msg
-		case message.DisconnectType:
-			if !n.Members.Contains(msg.From) {
-				// If the message peer is not a registered member of the current
-				// network, return a forbidden HTTP error.
-				http.Error(w, "Peer not registered", http.StatusForbidden)
-				return
-			}
-
-			// disconnected function deletes the message peer from the current
-			// network members.
-			n.Members.Delete(msg.From)
-			if n.Members.Len() == 0 {
-				n.setConnected(false)
-			}
-		default:
-			// By default response with 405 HTTP Status Code.
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
+		// disconnected function deletes the message peer from the current
+		// network members.
+		n.applyUpdates(msg.Updates)
+		n.leave(msg.From, "disconnected")
+		if n.Members.Len() == 0 {
+			n.setConnected(false)
 		}
+	case message.GossipType:
+		// Handle the broadcast messages disseminated epidemically, delivering
+		// them once and forwarding them to other members.
+		return n.handleGossip(msg)
+	case message.SubscribeType:
+		// Handle the topics announced by other members, responding with the
+		// topics of the current node.
+		return n.handleSubscribe(msg)
+	case message.PublishType:
+		// Handle the messages published to a topic, delivering them to the
+		// channel of the subscription to the topic.
+		return n.handlePublish(msg)
+	case message.RequestType:
+		// Handle the requests, responding with the result of the registered
+		// request handler.
+		return n.handleRequest(msg)
+	case message.CallType:
+		// Handle the calls to the registered services, responding with the
+		// result of the method called.
+		return n.handleCall(msg)
+	case message.ChunkType:
+		// Handle the chunks of the streams sent by other members, responding
+		// once every chunk is read from the stream.
+		return n.handleChunk(msg)
+	case message.BlobType:
+		// Handle the blobs announced and requested by other members,
+		// responding with the manifest or the chunks of the blobs requested.
+		return n.handleBlob(msg)
+	case message.PingType, message.PingReqType:
+		// Handle the failure detection probes, responding with an
+		// acknowledgement if the node has failure detection enabled.
+		return n.handlePing(msg)
+	default:
+		// By default response with a not allowed error.
+		return nil, transport.ErrNotAllowed
 	}
+	return nil, nil
 }
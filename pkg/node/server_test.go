@@ -1,6 +1,7 @@
 package node
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 	qt "github.com/frankban/quicktest"
 	"github.com/lucasmenendez/gop2p/pkg/message"
 	"github.com/lucasmenendez/gop2p/pkg/peer"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
 )
 
 func Test_startListening(t *testing.T) {
@@ -25,8 +27,7 @@ func Test_startListening(t *testing.T) {
 	})
 
 	t.Run("request to started server", func(t *testing.T) {
-		srv.server = &http.Server{Addr: srv.Self.String()}
-		go srv.startListening()
+		c.Assert(srv.startListening(), qt.DeepEquals, (*NodeErr)(nil))
 
 		req := prepareRequest(t, message.ConnectType, srv.Self.Port, getRandomPort(), nil)
 
@@ -54,8 +55,7 @@ func Test_startListening(t *testing.T) {
 				wg.Done()
 			}
 		}()
-		newSrv.server = &http.Server{Addr: newSrv.Self.String()}
-		go newSrv.startListening()
+		newSrv.Start()
 		wg.Wait()
 	})
 }
@@ -171,3 +171,25 @@ func Test_handleRequest(t *testing.T) {
 		c.Assert(res.StatusCode, qt.Equals, http.StatusForbidden)
 	})
 }
+
+func Test_handleMessageRelayed(t *testing.T) {
+	c := qt.New(t)
+
+	srv := initNode(t, getRandomPort())
+	member, _ := peer.Me(getRandomPort(), false)
+	srv.Members.Append(member)
+
+	// Relayed peers can not connect with the address of a direct member
+	impostor := &peer.Peer{Address: member.Address, Port: member.Port, Relay: srv.Self}
+	msg := new(message.Message).SetType(message.ConnectType).SetFrom(impostor)
+	_, err := srv.handleMessage(msg)
+	c.Assert(errors.Is(err, transport.ErrForbidden), qt.IsTrue)
+	c.Assert(srv.Members.Get(member).Relay, qt.IsNil)
+
+	// But other relayed peers can
+	relayed := &peer.Peer{Address: "browser", Port: 1, Relay: srv.Self}
+	msg = new(message.Message).SetType(message.ConnectType).SetFrom(relayed)
+	_, err = srv.handleMessage(msg)
+	c.Assert(err, qt.IsNil)
+	c.Assert(srv.Members.Contains(relayed), qt.IsTrue)
+}
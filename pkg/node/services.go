@@ -0,0 +1,121 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
+)
+
+// ServiceHandler function type handles the calls to the methods of a service
+// registered by a node. It receives the name of the method called, the peer
+// that calls it and the JSON encoded params, and returns the result of the
+// method, that is encoded to JSON, or an error that is returned to the caller.
+type ServiceHandler func(method string, from *peer.Peer, params json.RawMessage) (any, error)
+
+// call struct contains the method called by a service call message and its
+// params encoded to JSON.
+type call struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// RegisterService function registers the provided handler to respond to the
+// calls of other peers to the methods of the service with the provided name.
+// It returns an error if the name is empty, contains a dot, or a service with
+// the same name is already registered.
+func (n *Node) RegisterService(name string, handler ServiceHandler) error {
+	if name == "" || strings.Contains(name, ".") {
+		return InternalErr("no valid service name provided", nil)
+	} else if handler == nil {
+		return InternalErr("no service handler provided", nil)
+	}
+
+	n.rpc.mtx.Lock()
+	defer n.rpc.mtx.Unlock()
+	if _, exists := n.rpc.services[name]; exists {
+		return InternalErr("service already registered", nil)
+	}
+	n.rpc.services[name] = handler
+	return nil
+}
+
+// UnregisterService function unregisters the service with the provided name,
+// rejecting the next calls to its methods.
+func (n *Node) UnregisterService(name string) {
+	n.rpc.mtx.Lock()
+	defer n.rpc.mtx.Unlock()
+	delete(n.rpc.services, name)
+}
+
+// Call function calls the provided method of a service registered by the
+// provided peer, following the format 'service.method'. The provided params
+// are encoded to JSON, and the result returned by the method is decoded into
+// the provided reply, unless it is nil. It waits for the result until the
+// provided context is done or, if it has no deadline, up to the node per-peer
+// timeout. If the service or the method fails, it returns a remote error with
+// the error returned by the peer.
+func (n *Node) Call(ctx context.Context, to *peer.Peer, method string, params, reply any) error {
+	if service, _, ok := strings.Cut(method, "."); !ok || service == "" {
+		return InternalErr("no valid method provided, expected 'service.method'", nil)
+	}
+	encParams, err := json.Marshal(params)
+	if err != nil {
+		return ParseErr("error encoding the params", err)
+	}
+	data, err := json.Marshal(&call{Method: method, Params: encParams})
+	if err != nil {
+		return ParseErr("error encoding the call", err)
+	}
+
+	msg := new(message.Message).SetType(message.CallType).SetFrom(n.Self)
+	msg.Data = data
+	res, err := n.roundTrip(ctx, to, msg)
+	if err != nil {
+		return err
+	} else if reply == nil {
+		return nil
+	} else if err := json.Unmarshal(res, reply); err != nil {
+		return ParseErr("error decoding the result", err)
+	}
+	return nil
+}
+
+// handleCall function handles the service calls received, passing them to the
+// handler of the service called and responding with the result of the method
+// encoded to JSON, or its error. The calls to services not registered are
+// responded with an error too.
+func (n *Node) handleCall(msg *message.Message) ([]byte, error) {
+	if err := n.verifySender(msg); err != nil {
+		return nil, err
+	} else if err := n.decrypt(msg); err != nil {
+		return nil, err
+	}
+	n.applyUpdates(msg.Updates)
+
+	req := &call{}
+	if err := json.Unmarshal(msg.Data, req); err != nil {
+		return nil, fmt.Errorf("%w: %v", transport.ErrBadMessage, err)
+	}
+	service, method, _ := strings.Cut(req.Method, ".")
+	n.rpc.mtx.Lock()
+	handler, exists := n.rpc.services[service]
+	n.rpc.mtx.Unlock()
+	if !exists {
+		return n.respond(msg, nil, fmt.Errorf("unknown service '%s'", service))
+	}
+
+	result, err := handler(method, msg.From, req.Params)
+	if err != nil {
+		return n.respond(msg, nil, err)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return n.respond(msg, nil, fmt.Errorf("error encoding the result: %w", err))
+	}
+	return n.respond(msg, data, nil)
+}
@@ -0,0 +1,73 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/lucasmenendez/gop2p/pkg/nettest"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+)
+
+type sumParams struct {
+	A, B int
+}
+
+func TestNodeRegisterService(t *testing.T) {
+	c := qt.New(t)
+
+	n := New(&peer.Peer{Address: "localhost", Port: 5000})
+	handler := func(string, *peer.Peer, json.RawMessage) (any, error) { return nil, nil }
+	c.Assert(n.RegisterService("", handler), qt.IsNotNil)
+	c.Assert(n.RegisterService("math.sum", handler), qt.IsNotNil)
+	c.Assert(n.RegisterService("math", nil), qt.IsNotNil)
+	c.Assert(n.RegisterService("math", handler), qt.IsNil)
+	c.Assert(n.RegisterService("math", handler), qt.IsNotNil)
+	n.UnregisterService("math")
+	c.Assert(n.RegisterService("math", handler), qt.IsNil)
+}
+
+func TestNodeCall(t *testing.T) {
+	c := qt.New(t)
+
+	network := nettest.NewNetwork(1)
+	client := initMemoryNode(t, network, 5000)
+	server := initMemoryNode(t, network, 5001)
+	c.Assert(client.connect(context.Background(), server.Self), qt.DeepEquals, (*NodeErr)(nil))
+	ctx := context.Background()
+
+	err := server.RegisterService("math", func(method string, from *peer.Peer, params json.RawMessage) (any, error) {
+		c.Assert(from.Equal(client.Self), qt.IsTrue)
+		if method != "sum" {
+			return nil, fmt.Errorf("unknown method '%s'", method)
+		}
+		args := &sumParams{}
+		if err := json.Unmarshal(params, args); err != nil {
+			return nil, err
+		}
+		return args.A + args.B, nil
+	})
+	c.Assert(err, qt.IsNil)
+
+	// The params and the result are encoded
+	result := 0
+	c.Assert(client.Call(ctx, server.Self, "math.sum", &sumParams{A: 2, B: 3}, &result), qt.IsNil)
+	c.Assert(result, qt.Equals, 5)
+	c.Assert(client.Call(ctx, server.Self, "math.sum", &sumParams{A: 1}, nil), qt.IsNil)
+
+	// The errors of the services are returned to the caller
+	callErr := client.Call(ctx, server.Self, "math.div", nil, &result)
+	c.Assert(callErr, qt.ErrorAs, new(*NodeErr))
+	c.Assert(callErr.(*NodeErr).ErrCode, qt.Equals, REMOTE_ERR)
+	c.Assert(callErr, qt.ErrorMatches, ".*unknown method 'div'")
+	callErr = client.Call(ctx, server.Self, "strings.join", nil, nil)
+	c.Assert(callErr, qt.ErrorMatches, ".*unknown service 'strings'")
+	c.Assert(client.Call(ctx, server.Self, "sum", nil, nil), qt.IsNotNil)
+
+	// The results that can not be decoded into the reply return an error
+	text := ""
+	callErr = client.Call(ctx, server.Self, "math.sum", &sumParams{A: 1}, &text)
+	c.Assert(callErr.(*NodeErr).ErrCode, qt.Equals, PARSING_ERR)
+}
@@ -0,0 +1,314 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
+)
+
+const (
+	// defaultChunkSize contains the default size of the chunks in which the
+	// streams are split.
+	defaultChunkSize = 64 * 1024
+	// streamsBuffer contains the number of incoming streams that the
+	// Node.Streams channel keeps until they are read.
+	streamsBuffer = 16
+	// streamTimeout contains the time that a node waits for the next chunk of
+	// an incoming stream before aborting it.
+	streamTimeout = time.Minute
+)
+
+// ErrCorruptedStream is returned when the content of a stream received does
+// not match the hash or the size provided by its sender.
+var ErrCorruptedStream = fmt.Errorf("corrupted stream")
+
+// Progress struct contains the number of bytes of a stream already
+// transferred and its total size, or zero if it is unknown.
+type Progress struct {
+	Transferred int64
+	Total       int64
+}
+
+// Stream struct contains a stream received from other peer: its ID, the peer
+// that sends it and the name and the size provided by the sender. Its content
+// is read as it is received, and the sender waits for every chunk to be read
+// before sending the next one. The stream returns io.EOF once it is received
+// completely and its hash is verified, or an error if it is aborted or
+// corrupted.
+type Stream struct {
+	ID   string
+	From *peer.Peer
+	Name string
+	Size int64
+
+	reader   *io.PipeReader
+	writer   *io.PipeWriter
+	hash     hash.Hash
+	received atomic.Int64
+	next     uint64
+	timer    *time.Timer
+	mtx      *sync.Mutex
+}
+
+// Read function reads the content of the stream received, waiting for the
+// next chunk if it is required.
+func (s *Stream) Read(p []byte) (int, error) {
+	return s.reader.Read(p)
+}
+
+// Close function stops reading the stream, and the sender is notified when it
+// sends the next chunk.
+func (s *Stream) Close() error {
+	return s.reader.Close()
+}
+
+// Progress function returns the number of bytes of the stream received and
+// its total size.
+func (s *Stream) Progress() Progress {
+	return Progress{Transferred: s.received.Load(), Total: s.Size}
+}
+
+// streams struct contains the incoming streams that are being received, by
+// sender and ID.
+type streams struct {
+	incoming map[string]*Stream
+	mtx      *sync.Mutex
+}
+
+// newStreams function creates an empty streams.
+func newStreams() *streams {
+	return &streams{incoming: map[string]*Stream{}, mtx: &sync.Mutex{}}
+}
+
+// streamKey function returns the key of the stream with the provided ID sent
+// by the provided peer.
+func streamKey(from *peer.Peer, id string) string {
+	return from.String() + "/" + id
+}
+
+// SendStream function sends the content read from the provided reader to the
+// provided peer, that receives it through its Node.Streams channel with the
+// provided name and size (zero if it is unknown). The content is split into
+// chunks that are sent one by one, waiting for the peer to read every chunk
+// before sending the next one, so the content is never loaded into memory
+// completely. Each chunk must be read within the node per-peer timeout. The
+// provided progress function, if any, is called after every chunk is sent. It
+// returns the SHA-256 hash of the content, that the peer verifies once it is
+// received. If the context is done or a chunk can not be sent, the stream is
+// aborted.
+func (n *Node) SendStream(ctx context.Context, to *peer.Peer, name string, size int64, r io.Reader, progress func(Progress)) ([]byte, error) {
+	if !n.IsConnected() {
+		return nil, ConnErr("node not connected", nil)
+	} else if !n.Members.Contains(to) {
+		return nil, ConnErr("target peer is not into the network", nil)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, InternalErr("error generating the stream ID", err)
+	}
+
+	streamID := hex.EncodeToString(id)
+	digest := sha256.New()
+	// Read a chunk ahead to send the last chunk of content as the final one.
+	current, next := make([]byte, n.chunkSize), make([]byte, n.chunkSize)
+	read, final, err := readChunk(r, current)
+	sent := int64(0)
+	for seq := uint64(0); ; seq++ {
+		if err != nil {
+			n.abortStream(to, streamID, seq, "error reading the stream")
+			return nil, InternalErr("error reading the stream", err)
+		}
+		chunk := &message.Chunk{Stream: streamID, Seq: seq}
+		if seq == 0 {
+			chunk.Name, chunk.Size = name, size
+		}
+		digest.Write(current[:read])
+		nextRead := 0
+		if !final {
+			nextRead, final, err = readChunk(r, next)
+			if err == nil && final && nextRead == 0 {
+				// The content ends with the current chunk.
+				chunk.Final, chunk.Hash = true, digest.Sum(nil)
+			}
+		} else {
+			chunk.Final, chunk.Hash = true, digest.Sum(nil)
+		}
+
+		msg := new(message.Message).SetType(message.ChunkType).SetFrom(n.Self)
+		msg.Data, msg.Chunk, msg.To = bytes.Clone(current[:read]), chunk, []*peer.Peer{to}
+		if err := n.sendChunk(ctx, to, msg); err != nil {
+			n.abortStream(to, streamID, seq+1, err.Error())
+			return nil, err
+		}
+		sent += int64(read)
+		if progress != nil {
+			progress(Progress{Transferred: sent, Total: size})
+		}
+		if chunk.Final {
+			return chunk.Hash, nil
+		}
+		current, next, read = next, current, nextRead
+	}
+}
+
+// readChunk function reads the next chunk of the provided reader into the
+// provided buffer, returning the number of bytes read and if the reader has
+// no more content.
+func readChunk(r io.Reader, buf []byte) (int, bool, error) {
+	read, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return read, true, nil
+	}
+	return read, false, err
+}
+
+// sendChunk function sends the provided chunk message to the provided peer,
+// waiting until the peer receives it, up to the node per-peer timeout, or the
+// provided context is done.
+func (n *Node) sendChunk(ctx context.Context, to *peer.Peer, msg *message.Message) *NodeErr {
+	n.prepare(msg)
+	toMsg, nerr := n.outgoing(msg, to)
+	if nerr != nil {
+		return nerr
+	}
+	if n.peerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.peerTimeout)
+		defer cancel()
+	}
+	if _, err := n.sendContext(ctx, to, toMsg); err != nil {
+		return ConnErr("error sending the stream", err)
+	}
+	return nil
+}
+
+// abortStream function notifies to the provided peer that the stream with the
+// provided ID is aborted by the provided reason, ignoring any error.
+func (n *Node) abortStream(to *peer.Peer, id string, seq uint64, reason string) {
+	msg := new(message.Message).SetType(message.ChunkType).SetFrom(n.Self)
+	msg.Chunk, msg.Error, msg.To = &message.Chunk{Stream: id, Seq: seq, Final: true}, reason, []*peer.Peer{to}
+	n.prepare(msg)
+	n.sendWithin(n.ctx, to, msg, n.peerTimeout)
+}
+
+// handleChunk function handles the chunks of the streams received. The first
+// chunk of a stream delivers it to the Node.Streams channel, or rejects it
+// with a transport.ErrUnavailable error if the channel is full. Every chunk is
+// responded once it is read from the stream.
+func (n *Node) handleChunk(msg *message.Message) ([]byte, error) {
+	if err := n.verifySender(msg); err != nil {
+		return nil, err
+	} else if err := n.decrypt(msg); err != nil {
+		return nil, err
+	} else if msg.Chunk == nil || msg.Chunk.Stream == "" {
+		return nil, fmt.Errorf("%w: no stream chunk provided", transport.ErrBadMessage)
+	}
+	n.applyUpdates(msg.Updates)
+
+	key := streamKey(msg.From, msg.Chunk.Stream)
+	n.streams.mtx.Lock()
+	s, exists := n.streams.incoming[key]
+	if !exists {
+		if msg.Chunk.Seq != 0 || msg.Error != "" {
+			n.streams.mtx.Unlock()
+			return nil, fmt.Errorf("%w: unknown stream", transport.ErrBadMessage)
+		}
+		reader, writer := io.Pipe()
+		s = &Stream{
+			ID:     msg.Chunk.Stream,
+			From:   msg.From,
+			Name:   msg.Chunk.Name,
+			Size:   msg.Chunk.Size,
+			reader: reader,
+			writer: writer,
+			hash:   sha256.New(),
+			next:   0,
+			mtx:    &sync.Mutex{},
+		}
+		select {
+		case n.Streams <- s:
+		default:
+			n.streams.mtx.Unlock()
+			return nil, fmt.Errorf("%w: too many incoming streams", transport.ErrUnavailable)
+		}
+		n.streams.incoming[key] = s
+	}
+	n.streams.mtx.Unlock()
+	return nil, n.receiveChunk(key, s, msg)
+}
+
+// receiveChunk function writes the content of the provided chunk message into
+// the provided stream, waiting until it is read. The final chunk closes the
+// stream if its hash matches the content received, or aborts it if not.
+func (n *Node) receiveChunk(key string, s *Stream, msg *message.Message) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+
+	if msg.Error != "" {
+		n.closeStream(key, s, fmt.Errorf("stream aborted by the sender: %s", msg.Error))
+		return nil
+	} else if msg.Chunk.Seq != s.next {
+		n.closeStream(key, s, fmt.Errorf("%w: unexpected chunk", ErrCorruptedStream))
+		return fmt.Errorf("%w: unexpected chunk %d", transport.ErrBadMessage, msg.Chunk.Seq)
+	}
+	s.next++
+
+	s.hash.Write(msg.Data)
+	if _, err := s.writer.Write(msg.Data); err != nil {
+		n.closeStream(key, s, err)
+		return fmt.Errorf("%w: stream closed by the receiver", transport.ErrForbidden)
+	}
+	received := s.received.Add(int64(len(msg.Data)))
+
+	if msg.Chunk.Final {
+		if !bytes.Equal(s.hash.Sum(nil), msg.Chunk.Hash) || (s.Size > 0 && received != s.Size) {
+			n.closeStream(key, s, ErrCorruptedStream)
+			return fmt.Errorf("%w: %v", transport.ErrBadMessage, ErrCorruptedStream)
+		}
+		n.closeStream(key, s, nil)
+		return nil
+	}
+
+	// Abort the stream if the next chunk is not received in time.
+	s.timer = time.AfterFunc(streamTimeout, func() {
+		n.closeStream(key, s, fmt.Errorf("stream timeout"))
+	})
+	return nil
+}
+
+// closeStream function stops receiving the provided stream, closing it with
+// the provided error, or io.EOF if it is nil.
+func (n *Node) closeStream(key string, s *Stream, err error) {
+	n.streams.mtx.Lock()
+	if n.streams.incoming[key] == s {
+		delete(n.streams.incoming, key)
+	}
+	n.streams.mtx.Unlock()
+	s.writer.CloseWithError(err)
+}
+
+// closeStreams function aborts every incoming stream.
+func (n *Node) closeStreams() {
+	n.streams.mtx.Lock()
+	incoming := n.streams.incoming
+	n.streams.incoming = map[string]*Stream{}
+	n.streams.mtx.Unlock()
+	for _, s := range incoming {
+		s.writer.CloseWithError(fmt.Errorf("node stopped"))
+	}
+}
@@ -0,0 +1,158 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/nettest"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
+)
+
+// failingReader struct returns the provided data and then the provided error.
+type failingReader struct {
+	data []byte
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestNodeSendStream(t *testing.T) {
+	c := qt.New(t)
+
+	network := nettest.NewNetwork(1)
+	sender := initMemoryNode(t, network, 5000)
+	receiver := initMemoryNode(t, network, 5001)
+	WithChunkSize(4)(sender)
+	ctx := context.Background()
+	content := []byte("streamed content")
+
+	_, err := sender.SendStream(ctx, receiver.Self, "file", 0, bytes.NewReader(content), nil)
+	c.Assert(err, qt.ErrorAs, new(*NodeErr))
+	c.Assert(err.(*NodeErr).ErrCode, qt.Equals, CONNECTION_ERR)
+	c.Assert(sender.connect(context.Background(), receiver.Self), qt.DeepEquals, (*NodeErr)(nil))
+
+	// The content is received completely, and the sender waits for every
+	// chunk to be read before sending the next one
+	type result struct {
+		hash []byte
+		err  error
+	}
+	results := make(chan result, 1)
+	progress := make(chan Progress, 16)
+	go func() {
+		hash, err := sender.SendStream(ctx, receiver.Self, "file", int64(len(content)), bytes.NewReader(content), func(p Progress) {
+			progress <- p
+		})
+		results <- result{hash, err}
+	}()
+	stream := <-receiver.Streams
+	c.Assert(stream.From.Equal(sender.Self), qt.IsTrue)
+	c.Assert(stream.Name, qt.Equals, "file")
+	c.Assert(stream.Size, qt.Equals, int64(len(content)))
+	select {
+	case <-progress:
+		t.Fatal("chunk sent before being read")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	received, readErr := io.ReadAll(stream)
+	c.Assert(readErr, qt.IsNil)
+	c.Assert(received, qt.DeepEquals, content)
+	c.Assert(stream.Progress(), qt.Equals, Progress{Transferred: 16, Total: 16})
+	res := <-results
+	c.Assert(res.err, qt.IsNil)
+	expected := sha256.Sum256(content)
+	c.Assert(res.hash, qt.DeepEquals, expected[:])
+	close(progress)
+	last := Progress{}
+	for p := range progress {
+		c.Assert(p.Transferred > last.Transferred, qt.IsTrue)
+		last = p
+	}
+	c.Assert(last, qt.Equals, Progress{Transferred: 16, Total: 16})
+
+	// Streams closed by the receiver stop the sender
+	go func() {
+		_, err := sender.SendStream(ctx, receiver.Self, "closed", 0, bytes.NewReader(content), nil)
+		results <- result{nil, err}
+	}()
+	stream = <-receiver.Streams
+	c.Assert(stream.Close(), qt.IsNil)
+	res = <-results
+	c.Assert(errors.Is(res.err, transport.ErrForbidden), qt.IsTrue)
+
+	// Streams aborted by the sender return its error to the receiver
+	go func() {
+		reader := &failingReader{data: content[:6], err: fmt.Errorf("disk failure")}
+		_, err := sender.SendStream(ctx, receiver.Self, "aborted", 0, reader, nil)
+		results <- result{nil, err}
+	}()
+	stream = <-receiver.Streams
+	_, readErr = io.ReadAll(stream)
+	c.Assert(readErr, qt.ErrorMatches, "stream aborted by the sender: .*")
+	res = <-results
+	c.Assert(res.err, qt.ErrorMatches, ".*disk failure")
+}
+
+func TestNodeCorruptedStream(t *testing.T) {
+	c := qt.New(t)
+
+	network := nettest.NewNetwork(1)
+	sender := initMemoryNode(t, network, 5000)
+	receiver := initMemoryNode(t, network, 5001)
+	c.Assert(sender.connect(context.Background(), receiver.Self), qt.DeepEquals, (*NodeErr)(nil))
+	chunk := func(chunk *message.Chunk, data string) error {
+		msg := new(message.Message).SetType(message.ChunkType).SetFrom(sender.Self)
+		msg.Data, msg.Chunk = []byte(data), chunk
+		_, err := network.Transport().Send(context.Background(), receiver.Self, msg)
+		return err
+	}
+	read := func() chan error {
+		errs := make(chan error, 1)
+		go func() {
+			_, err := io.ReadAll(<-receiver.Streams)
+			errs <- err
+		}()
+		return errs
+	}
+
+	// Chunks of unknown streams are rejected
+	err := chunk(&message.Chunk{Stream: "unknown", Seq: 1}, "data")
+	c.Assert(errors.Is(err, transport.ErrBadMessage), qt.IsTrue)
+
+	// Streams whose content does not match the hash are corrupted
+	errs := read()
+	c.Assert(chunk(&message.Chunk{Stream: "hash"}, "data"), qt.IsNil)
+	err = chunk(&message.Chunk{Stream: "hash", Seq: 1, Final: true, Hash: []byte("wrong")}, "")
+	c.Assert(errors.Is(err, transport.ErrBadMessage), qt.IsTrue)
+	c.Assert(errors.Is(<-errs, ErrCorruptedStream), qt.IsTrue)
+
+	// Streams whose content does not match the size are corrupted
+	errs = read()
+	hash := sha256.Sum256([]byte("data"))
+	err = chunk(&message.Chunk{Stream: "size", Size: 10, Final: true, Hash: hash[:]}, "data")
+	c.Assert(errors.Is(err, transport.ErrBadMessage), qt.IsTrue)
+	c.Assert(errors.Is(<-errs, ErrCorruptedStream), qt.IsTrue)
+
+	// Streams with chunks out of order are corrupted
+	errs = read()
+	c.Assert(chunk(&message.Chunk{Stream: "order"}, "data"), qt.IsNil)
+	err = chunk(&message.Chunk{Stream: "order", Seq: 2}, "data")
+	c.Assert(errors.Is(err, transport.ErrBadMessage), qt.IsTrue)
+	c.Assert(errors.Is(<-errs, ErrCorruptedStream), qt.IsTrue)
+}
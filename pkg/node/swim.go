@@ -0,0 +1,408 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
+)
+
+// retransmitMult contains the multiplier of the number of times that a
+// membership update is piggybacked, that is retransmitMult * log2(n) for a
+// network of n members.
+const retransmitMult = 3
+
+// SWIMConfig struct contains the parameters of the SWIM failure detection:
+// every Period, the node pings a member and waits for its response during
+// PingTimeout. If it does not respond, the node requests to IndirectPings
+// members to ping it. If none of them receive a response during the rest of
+// the period, the member is suspected, and if it does not refute the
+// suspicion during SuspicionTimeout, it is confirmed as failed and removed.
+// MaxUpdates limits the number of membership updates piggybacked on each
+// message.
+type SWIMConfig struct {
+	Period           time.Duration
+	PingTimeout      time.Duration
+	SuspicionTimeout time.Duration
+	IndirectPings    int
+	MaxUpdates       int
+}
+
+// DefaultSWIMConfig function returns the default parameters of the SWIM
+// failure detection.
+func DefaultSWIMConfig() *SWIMConfig {
+	return &SWIMConfig{
+		Period:           time.Second,
+		PingTimeout:      300 * time.Millisecond,
+		SuspicionTimeout: 5 * time.Second,
+		IndirectPings:    3,
+		MaxUpdates:       8,
+	}
+}
+
+// queuedUpdate struct contains a membership update pending to be
+// disseminated and the number of times that it has been piggybacked.
+type queuedUpdate struct {
+	update        *peer.Update
+	transmissions int
+}
+
+// swim struct contains the state of the SWIM protocol of a node: its
+// configuration, the incarnation of the node and the membership updates
+// pending to be disseminated.
+type swim struct {
+	config      *SWIMConfig
+	incarnation uint64
+	queue       []*queuedUpdate
+	mtx         *sync.Mutex
+}
+
+// newSWIM function creates the state of the SWIM protocol with a copy of the
+// provided configuration, using the default values for the parameters not
+// provided.
+func newSWIM(provided *SWIMConfig) *swim {
+	defaults := DefaultSWIMConfig()
+	config := defaults
+	if provided != nil {
+		copied := *provided
+		config = &copied
+	}
+	if config.Period <= 0 {
+		config.Period = defaults.Period
+	}
+	if config.PingTimeout <= 0 || config.PingTimeout >= config.Period {
+		config.PingTimeout = config.Period / 3
+	}
+	if config.SuspicionTimeout <= 0 {
+		config.SuspicionTimeout = defaults.SuspicionTimeout
+	}
+	if config.IndirectPings < 0 {
+		config.IndirectPings = defaults.IndirectPings
+	}
+	if config.MaxUpdates <= 0 {
+		config.MaxUpdates = defaults.MaxUpdates
+	}
+	return &swim{config: config, incarnation: 0, queue: []*queuedUpdate{}, mtx: &sync.Mutex{}}
+}
+
+// enqueue function adds the provided update to the pending ones, replacing
+// any other pending update about the same peer.
+func (s *swim) enqueue(update *peer.Update) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, queued := range s.queue {
+		if queued.update.Peer.Equal(update.Peer) {
+			queued.update, queued.transmissions = update, 0
+			return
+		}
+	}
+	s.queue = append(s.queue, &queuedUpdate{update: update, transmissions: 0})
+}
+
+// forget function discards the pending updates about the provided peer.
+func (s *swim) forget(p *peer.Peer) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	queue := []*queuedUpdate{}
+	for _, queued := range s.queue {
+		if !queued.update.Peer.Equal(p) {
+			queue = append(queue, queued)
+		}
+	}
+	s.queue = queue
+}
+
+// refute function increments the incarnation of the node over the provided
+// one and returns it.
+func (s *swim) refute(incarnation uint64) uint64 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if incarnation >= s.incarnation {
+		s.incarnation = incarnation + 1
+	}
+	return s.incarnation
+}
+
+// piggyback function returns the pending updates to disseminate in the next
+// message, prioritizing the less transmitted ones, and discards the updates
+// transmitted enough times for a network of the provided size.
+func (s *swim) piggyback(members int) []*peer.Update {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	sort.SliceStable(s.queue, func(i, j int) bool {
+		return s.queue[i].transmissions < s.queue[j].transmissions
+	})
+	limit := retransmitMult * bits.Len(uint(members+1))
+	updates, queue := []*peer.Update{}, []*queuedUpdate{}
+	for _, queued := range s.queue {
+		if len(updates) < s.config.MaxUpdates {
+			updates = append(updates, queued.update)
+			queued.transmissions++
+		}
+		if queued.transmissions < limit {
+			queue = append(queue, queued)
+		}
+	}
+	s.queue = queue
+	if len(updates) == 0 {
+		return nil
+	}
+	return updates
+}
+
+// detectFailures function probes a network member every protocol period,
+// iterating over them in random order, until the node context is canceled.
+func (n *Node) detectFailures() {
+	ticker := time.NewTicker(n.swim.config.Period)
+	defer ticker.Stop()
+
+	probes := []*peer.Peer{}
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-ticker.C:
+			if !n.IsConnected() {
+				continue
+			}
+			// Take the next member to probe, shuffling the members again
+			// when every one has been probed.
+			if len(probes) == 0 {
+				probes = append(probes, n.Members.Peers()...)
+				rand.Shuffle(len(probes), func(i, j int) {
+					probes[i], probes[j] = probes[j], probes[i]
+				})
+			}
+			if len(probes) > 0 {
+				target := probes[0]
+				probes = probes[1:]
+				if n.Members.Contains(target) {
+					n.probe(target)
+				}
+			}
+		}
+	}
+}
+
+// probe function pings the provided member and, if it does not respond,
+// requests to other members to ping it. If no response is received during the
+// protocol period, the member is suspected.
+func (n *Node) probe(target *peer.Peer) {
+	if err := n.ping(target); err == nil {
+		return
+	}
+
+	helpers := []*peer.Peer{}
+	for _, member := range n.Members.Peers() {
+		if !member.Equal(target) {
+			helpers = append(helpers, member)
+		}
+	}
+	rand.Shuffle(len(helpers), func(i, j int) {
+		helpers[i], helpers[j] = helpers[j], helpers[i]
+	})
+	if len(helpers) > n.swim.config.IndirectPings {
+		helpers = helpers[:n.swim.config.IndirectPings]
+	}
+
+	acks := make(chan error, len(helpers))
+	for _, helper := range helpers {
+		go func(helper *peer.Peer) {
+			acks <- n.pingReq(helper, target)
+		}(helper)
+	}
+	timeout := time.After(n.swim.config.Period - n.swim.config.PingTimeout)
+	for range helpers {
+		select {
+		case err := <-acks:
+			if err == nil {
+				return
+			}
+		case <-timeout:
+			n.suspect(target)
+			return
+		}
+	}
+	n.suspect(target)
+}
+
+// ping function sends a ping message to the provided peer and waits for its
+// response, applying the membership updates received with it.
+func (n *Node) ping(to *peer.Peer) error {
+	msg := new(message.Message).SetType(message.PingType).SetFrom(n.Self)
+	res, err := n.sendTimeout(to, msg, n.swim.config.PingTimeout)
+	if err != nil {
+		return err
+	}
+	n.handleAck(res)
+	return nil
+}
+
+// pingReq function requests to the provided helper to ping the provided target
+// and waits for its response until the end of the protocol period.
+func (n *Node) pingReq(helper, target *peer.Peer) error {
+	data, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+
+	msg := new(message.Message).SetType(message.PingReqType).SetFrom(n.Self)
+	msg.Data = data
+	timeout := n.swim.config.Period - n.swim.config.PingTimeout
+	res, err := n.sendTimeout(helper, msg, timeout)
+	if err != nil {
+		return err
+	}
+	n.handleAck(res)
+	return nil
+}
+
+// sendTimeout function prepares the provided message and sends it to the
+// provided peer, returning the response or an error if it is not received
+// before the timeout.
+func (n *Node) sendTimeout(to *peer.Peer, msg *message.Message, timeout time.Duration) ([]byte, error) {
+	n.prepare(msg)
+	return n.sendWithin(n.ctx, to, msg, timeout)
+}
+
+// handlePing function handles the ping and ping request messages received. A
+// ping message is responded with an acknowledgement that includes pending
+// membership updates. A ping request message makes the node ping the target
+// peer contained in the message data, and it is responded only if the target
+// responds.
+func (n *Node) handlePing(msg *message.Message) ([]byte, error) {
+	if n.swim == nil {
+		return nil, transport.ErrNotAllowed
+	} else if err := n.verifySender(msg); err != nil {
+		return nil, err
+	}
+	n.applyUpdates(msg.Updates)
+
+	if msg.Type == message.PingReqType {
+		// Only the members can be probed on behalf of other member.
+		target := new(peer.Peer)
+		if err := json.Unmarshal(msg.Data, target); err != nil {
+			return nil, fmt.Errorf("%w: %v", transport.ErrBadMessage, err)
+		}
+		member := n.Members.Get(target)
+		if member == nil {
+			return nil, fmt.Errorf("%w: ping target is not a member", transport.ErrForbidden)
+		} else if err := n.ping(member); err != nil {
+			return nil, err
+		}
+	}
+	return n.ack(), nil
+}
+
+// ack function returns the content of the acknowledgement of a ping message,
+// that contains the pending membership updates.
+func (n *Node) ack() []byte {
+	updates := n.swim.piggyback(n.Members.Len())
+	if updates == nil {
+		return nil
+	}
+	res, _ := json.Marshal(updates)
+	return res
+}
+
+// handleAck function applies the membership updates included in the provided
+// acknowledgement.
+func (n *Node) handleAck(res []byte) {
+	if len(res) == 0 {
+		return
+	}
+	updates := []*peer.Update{}
+	if err := json.Unmarshal(res, &updates); err == nil {
+		n.applyUpdates(updates)
+	}
+}
+
+// piggyback function includes the pending membership updates into the
+// provided message, if the node has failure detection enabled.
+func (n *Node) piggyback(msg *message.Message) {
+	if n.swim != nil {
+		msg.Updates = n.swim.piggyback(n.Members.Len())
+	}
+}
+
+// suspect function marks the provided member as suspected and disseminates it.
+func (n *Node) suspect(target *peer.Peer) {
+	if _, incarnation, ok := n.Members.Status(target); ok {
+		n.applyUpdates([]*peer.Update{{Peer: target, State: peer.Suspect, Incarnation: incarnation}})
+	}
+}
+
+// applyUpdates function applies the provided membership updates received from
+// other members to the current members, disseminating the accepted ones. If
+// the node is suspected or confirmed as failed, it refutes it disseminating
+// a greater incarnation. When a member is suspected, it will be confirmed as
+// failed if it does not refute it before the suspicion timeout.
+func (n *Node) applyUpdates(updates []*peer.Update) {
+	if n.swim == nil {
+		return
+	}
+
+	for _, update := range updates {
+		if update == nil || update.Peer == nil {
+			continue
+		} else if update.Peer.Equal(n.Self) {
+			if update.State != peer.Alive {
+				incarnation := n.swim.refute(update.Incarnation)
+				n.swim.enqueue(&peer.Update{Peer: n.Self, State: peer.Alive, Incarnation: incarnation})
+			}
+			continue
+		}
+
+		state, _, known := n.Members.Status(update.Peer)
+		if !known && n.key != nil && update.Peer.PublicKey == nil {
+			// If the current node has identity, the peers without it can not
+			// join the network, neither announced by other members.
+			continue
+		} else if !n.Members.Apply(update) {
+			continue
+		}
+
+		n.swim.enqueue(update)
+		switch update.State {
+		case peer.Alive:
+			n.setConnected(true)
+			if !known {
+				n.emit(PeerJoined, update.Peer, "announced by a member")
+			} else if state == peer.Suspect {
+				n.emit(PeerRecovered, update.Peer, "suspicion refuted")
+			}
+		case peer.Suspect:
+			n.emit(PeerSuspected, update.Peer, "not responding to probes")
+			target, incarnation := update.Peer, update.Incarnation
+			time.AfterFunc(n.swim.config.SuspicionTimeout, func() {
+				n.confirm(target, incarnation)
+			})
+		case peer.Failed:
+			n.pubsub.forget(update.Peer)
+			n.emit(PeerFailed, update.Peer, "suspicion not refuted")
+			if n.Members.Len() == 0 {
+				n.setConnected(false)
+			}
+		}
+	}
+}
+
+// confirm function confirms the provided member as failed if it is still
+// suspected with the provided incarnation.
+func (n *Node) confirm(target *peer.Peer, incarnation uint64) {
+	if n.ctx.Err() != nil {
+		return
+	}
+	state, current, ok := n.Members.Status(target)
+	if ok && state == peer.Suspect && current == incarnation {
+		n.applyUpdates([]*peer.Update{{Peer: target, State: peer.Failed, Incarnation: incarnation}})
+	}
+}
@@ -0,0 +1,135 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/nettest"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+	"github.com/lucasmenendez/gop2p/pkg/transport"
+)
+
+// testSWIMConfig function returns a SWIM configuration with short timeouts to
+// speed up the tests.
+func testSWIMConfig() *SWIMConfig {
+	return &SWIMConfig{
+		Period:           50 * time.Millisecond,
+		PingTimeout:      15 * time.Millisecond,
+		SuspicionTimeout: 150 * time.Millisecond,
+		IndirectPings:    2,
+		MaxUpdates:       8,
+	}
+}
+
+func Test_swimPiggyback(t *testing.T) {
+	c := qt.New(t)
+
+	config := &SWIMConfig{MaxUpdates: 2}
+	s := newSWIM(config)
+	c.Assert(s.config.Period, qt.Equals, DefaultSWIMConfig().Period)
+	c.Assert(config.Period, qt.Equals, time.Duration(0))
+	c.Assert(s.piggyback(1), qt.IsNil)
+
+	examples := []*peer.Peer{}
+	for port := 5000; port < 5003; port++ {
+		p, _ := peer.New("localhost", port)
+		examples = append(examples, p)
+		s.enqueue(&peer.Update{Peer: p, State: peer.Suspect})
+	}
+	// Updates about the same peer are replaced
+	s.enqueue(&peer.Update{Peer: examples[0], State: peer.Failed})
+	c.Assert(s.queue, qt.HasLen, 3)
+
+	// The less transmitted updates are piggybacked first, up to the limit
+	updates := s.piggyback(1)
+	c.Assert(updates, qt.HasLen, 2)
+	c.Assert(updates[0].State, qt.Equals, peer.Failed)
+	updates = s.piggyback(1)
+	c.Assert(updates, qt.HasLen, 2)
+	c.Assert(updates[0].Peer, qt.Equals, examples[2])
+
+	// Updates are discarded after being transmitted enough times
+	for i := 0; i < 10; i++ {
+		s.piggyback(1)
+	}
+	c.Assert(s.piggyback(1), qt.IsNil)
+
+	s.enqueue(&peer.Update{Peer: examples[1], State: peer.Suspect})
+	s.forget(examples[1])
+	c.Assert(s.queue, qt.HasLen, 0)
+}
+
+func TestNodeSWIM(t *testing.T) {
+	c := qt.New(t)
+
+	network := nettest.NewNetwork(1)
+	newNode := func(port int) *Node {
+		p, _ := peer.New("localhost", port)
+		n := New(p, WithTransport(network.Transport()), WithSWIM(testSWIMConfig()))
+		n.Start()
+		return n
+	}
+
+	entryPoint := newNode(5000)
+	first := newNode(5001)
+	second := newNode(5002)
+	crashed := newNode(5003)
+	for _, n := range []*Node{first, second, crashed} {
+		c.Assert(n.connect(context.Background(), entryPoint.Self), qt.DeepEquals, (*NodeErr)(nil))
+	}
+
+	// Suspicions about the node itself are refuted with a greater incarnation
+	first.applyUpdates([]*peer.Update{{Peer: first.Self, State: peer.Suspect, Incarnation: 4}})
+	c.Assert(first.swim.incarnation, qt.Equals, uint64(5))
+
+	// Only the members can be probed on behalf of other member
+	stranger, _ := peer.New("localhost", 5004)
+	for target, expected := range map[*peer.Peer]error{second.Self: nil, stranger: transport.ErrForbidden} {
+		pingReq := new(message.Message).SetType(message.PingReqType).SetFrom(first.Self)
+		pingReq.Data, _ = json.Marshal(target)
+		_, err := entryPoint.handlePing(pingReq)
+		if expected == nil {
+			c.Assert(err, qt.IsNil)
+		} else {
+			c.Assert(err, qt.ErrorIs, expected)
+		}
+	}
+
+	// A crashed node is detected and removed from every member list
+	network.Partition([]*peer.Peer{crashed.Self})
+	alive := []*Node{entryPoint, first, second}
+	c.Assert(waitFor(func() bool {
+		for _, n := range alive {
+			if n.Members.Contains(crashed.Self) {
+				return false
+			}
+		}
+		return true
+	}), qt.IsTrue)
+
+	// Alive nodes are kept, including the one that was suspected
+	for _, n := range alive {
+		c.Assert(n.Members.Len(), qt.Equals, 2)
+		c.Assert(n.IsConnected(), qt.IsTrue)
+	}
+	state, incarnation, ok := entryPoint.Members.Status(first.Self)
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(state, qt.Equals, peer.Alive)
+	c.Assert(incarnation, qt.Equals, uint64(5))
+}
+
+// waitFor function waits until the provided condition is true, returning false
+// if it is not true after some seconds.
+func waitFor(condition func() bool) bool {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if condition() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return condition()
+}
@@ -1,8 +1,7 @@
 package node
 
 import (
-	"bytes"
-	"net/http"
+	"context"
 
 	"github.com/lucasmenendez/gop2p/pkg/message"
 	"github.com/lucasmenendez/gop2p/pkg/peer"
@@ -15,19 +14,32 @@ func (node *Node) setConnected(connected bool) {
 	node.connected = connected
 }
 
-func composeRequest(msg *message.Message, to *peer.Peer) (*http.Request, error) {
-	encMsg := msg.JSON()
-	if encMsg == nil {
-		return nil, ParseErr("error encoding message to JSON", nil)
-	}
-	body := bytes.NewBuffer(encMsg)
-	req, err := http.NewRequest(http.MethodPost, to.Hostname(), body)
-	if err != nil {
-		return nil, ParseErr("error decoding request to message", err)
+// prepare function prepares the provided message to be sent: stamps it with
+// an ID and a timestamp if it has not, piggybacks the pending membership
+// updates and signs it if the node has identity.
+func (n *Node) prepare(msg *message.Message) {
+	msg.Stamp()
+	n.piggyback(msg)
+	n.sign(msg)
+}
+
+// run function performs the provided action with the provided context and
+// returns its error, or the context error if it is done before the action
+// finishes. The action must stop once the context is done, rolling back its
+// changes to the node, so the node does not change after run returns. The
+// messages already sent by the action are not recalled.
+func (n *Node) run(ctx context.Context, action func(context.Context) *NodeErr) error {
+	if err := ctx.Err(); err != nil {
+		return ConnErr("action not performed", err)
 	}
-	req.Host = msg.From.String()
 
-	return req, nil
+	if err := action(ctx); err != nil {
+		if ctx.Err() != nil {
+			return ConnErr("action not completed", ctx.Err())
+		}
+		return err
+	}
+	return nil
 }
 
 // safeClose function allows closing gracefully any Node channel avoiding
@@ -5,19 +5,54 @@ import (
 	"sync"
 )
 
+// State type represents the state of a network member known by the current
+// peer, following the SWIM failure detection protocol.
+type State int
+
+const (
+	// Alive identifies a member that responds to the current peer or other
+	// members.
+	Alive State = iota
+	// Suspect identifies a member that does not respond and it is suspected
+	// to be failed, but it can refute the suspicion.
+	Suspect State = iota
+	// Failed identifies a member confirmed as failed, that is removed from
+	// the members.
+	Failed State = iota
+)
+
+// Update struct contains a change of the state of a network member, that is
+// disseminated to the other members. The Incarnation is a counter that only
+// the member updated can increment, to refute the suspicions about it,
+// allowing to order the updates about the same member.
+type Update struct {
+	Peer        *Peer  `json:"peer"`
+	State       State  `json:"state"`
+	Incarnation uint64 `json:"incarnation"`
+}
+
+// status struct contains the state and the incarnation known of a member.
+type status struct {
+	state       State
+	incarnation uint64
+}
+
 // Members struct abstracts a thread-safe list of network peers. It includes
-// a slice of peers and a mutex to modify it safely. Both private arguments to
-// keep the control of the data isolated on this package.
+// a slice of peers, the state of each one and a mutex to modify them safely.
+// Every private arguments to keep the control of the data isolated on this
+// package.
 type Members struct {
-	mutex *sync.Mutex
-	peers []*Peer
+	mutex  *sync.Mutex
+	peers  []*Peer
+	states map[*Peer]*status
 }
 
 // panicIfNotInitialized function calls panic if the provided Members is not
-// initialized with a empty slice of *Peer's and an initialized mutex to protect
-// the access to it.
+// initialized with an initialized mutex to protect the access to it and the
+// states of its peers. It does not check the slice of peers, because it can
+// be modified concurrently.
 func panicIfNotInitialized(members *Members) {
-	if members.mutex == nil || members.peers == nil {
+	if members.mutex == nil || members.states == nil {
 		panic("current Members struct instance not initialized, use NewMembers() function")
 	}
 }
@@ -25,8 +60,9 @@ func panicIfNotInitialized(members *Members) {
 // NewMembers function intializes a new Members struct and return it.
 func NewMembers() *Members {
 	return &Members{
-		mutex: &sync.Mutex{},
-		peers: []*Peer{},
+		mutex:  &sync.Mutex{},
+		peers:  []*Peer{},
+		states: map[*Peer]*status{},
 	}
 }
 
@@ -37,7 +73,7 @@ func (m *Members) Peers() []*Peer {
 
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	return m.peers
+	return append([]*Peer{}, m.peers...)
 }
 
 // Len function returns the number of peers that current members contains
@@ -85,6 +121,8 @@ func (m *Members) Delete(peer *Peer) *Members {
 	for _, member := range m.peers {
 		if !member.Equal(peer) {
 			peers = append(peers, member)
+		} else {
+			delete(m.states, member)
 		}
 	}
 
@@ -107,6 +145,154 @@ func (m *Members) Contains(peer *Peer) bool {
 	return false
 }
 
+// Get function returns the registered member that is equal to the provided
+// peer safely, or nil if it is not registered into the current members.
+func (m *Members) Get(peer *Peer) *Peer {
+	panicIfNotInitialized(m)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, member := range m.peers {
+		if member.Equal(peer) {
+			return member
+		}
+	}
+	return nil
+}
+
+// Replace function replaces safely the registered member that is equal to the
+// provided peer with it, keeping its state, to update the information of the
+// member, such as its metadata. It returns if the peer was a member.
+func (m *Members) Replace(peer *Peer) bool {
+	panicIfNotInitialized(m)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for i, member := range m.peers {
+		if member.Equal(peer) {
+			m.peers[i] = peer
+			if st, ok := m.states[member]; ok {
+				delete(m.states, member)
+				m.states[peer] = st
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Select function returns safely the members that satisfy the provided filter,
+// for example, the ones that advertise a role in their metadata.
+func (m *Members) Select(filter func(*Peer) bool) []*Peer {
+	panicIfNotInitialized(m)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	selected := []*Peer{}
+	for _, member := range m.peers {
+		if filter(member) {
+			selected = append(selected, member)
+		}
+	}
+	return selected
+}
+
+// Status function returns the state and the incarnation known of the provided
+// peer safely, and if it is a registered member. The members registered
+// without updates are alive with the incarnation 0.
+func (m *Members) Status(peer *Peer) (State, uint64, bool) {
+	panicIfNotInitialized(m)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	member := m.get(peer)
+	if member == nil {
+		return Failed, 0, false
+	}
+	st := m.status(member)
+	return st.state, st.incarnation, true
+}
+
+// Apply function applies the provided update to the current members safely,
+// following the SWIM rules, and returns if it was accepted (it changes the
+// members):
+//   - An alive update registers an unknown peer, or overrides the state of a
+//     known one if its incarnation is greater.
+//   - A suspect update overrides the state of an alive member if its
+//     incarnation is greater or equal, or a suspected one if it is greater.
+//   - A failed update removes a member if its incarnation is greater or equal.
+func (m *Members) Apply(update *Update) bool {
+	panicIfNotInitialized(m)
+	if update == nil || update.Peer == nil {
+		return false
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	member := m.get(update.Peer)
+	if member == nil {
+		if update.State != Alive {
+			return false
+		}
+		m.peers = append(m.peers, update.Peer)
+		m.states[update.Peer] = &status{state: Alive, incarnation: update.Incarnation}
+		return true
+	}
+
+	st := m.status(member)
+	switch update.State {
+	case Alive:
+		if update.Incarnation <= st.incarnation {
+			return false
+		}
+	case Suspect:
+		if update.Incarnation < st.incarnation ||
+			(st.state == Suspect && update.Incarnation == st.incarnation) {
+			return false
+		}
+	case Failed:
+		if update.Incarnation < st.incarnation {
+			return false
+		}
+		peers := []*Peer{}
+		for _, p := range m.peers {
+			if p != member {
+				peers = append(peers, p)
+			}
+		}
+		m.peers = peers
+		delete(m.states, member)
+		return true
+	default:
+		return false
+	}
+
+	st.state, st.incarnation = update.State, update.Incarnation
+	return true
+}
+
+// get function returns the registered member that is equal to the provided
+// peer, or nil. The mutex must be locked.
+func (m *Members) get(peer *Peer) *Peer {
+	for _, member := range m.peers {
+		if member.Equal(peer) {
+			return member
+		}
+	}
+	return nil
+}
+
+// status function returns the status of the provided member, initializing it
+// as alive if it has not been updated yet. The mutex must be locked.
+func (m *Members) status(member *Peer) *status {
+	st, ok := m.states[member]
+	if !ok {
+		st = &status{state: Alive, incarnation: 0}
+		m.states[member] = st
+	}
+	return st
+}
+
 // ToJSON function encodes the current list of network members into a JSON
 // format and returns it as slice of bytes. If something was wrong, returns an
 // error.
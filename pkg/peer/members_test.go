@@ -120,6 +120,110 @@ func TestMembersContains(t *testing.T) {
 	c.Assert(result.Contains(needle), qt.IsFalse)
 }
 
+func TestMembersGet(t *testing.T) {
+	c := qt.New(t)
+
+	result := NewMembers()
+	expected := getExamples(3)
+	for _, member := range expected {
+		result.Append(member)
+	}
+
+	needle := &Peer{Address: expected[1].Address, Port: expected[1].Port}
+	c.Assert(result.Get(needle), qt.Equals, expected[1])
+	needle, _ = Me(5003, false)
+	c.Assert(result.Get(needle), qt.IsNil)
+}
+
+func TestMembersReplace(t *testing.T) {
+	c := qt.New(t)
+
+	result := NewMembers()
+	expected := getExamples(3)
+	for _, member := range expected {
+		result.Append(member)
+	}
+	c.Assert(result.Apply(&Update{Peer: expected[1], State: Suspect, Incarnation: 2}), qt.IsTrue)
+
+	// The member is replaced keeping its state
+	updated := &Peer{Address: expected[1].Address, Port: expected[1].Port, Metadata: map[string]string{"role": "builder"}}
+	c.Assert(result.Replace(updated), qt.IsTrue)
+	c.Assert(result.Get(expected[1]), qt.Equals, updated)
+	c.Assert(result.Len(), qt.Equals, 3)
+	state, incarnation, known := result.Status(updated)
+	c.Assert(state, qt.Equals, Suspect)
+	c.Assert(incarnation, qt.Equals, uint64(2))
+	c.Assert(known, qt.IsTrue)
+
+	unknown, _ := Me(5003, false)
+	c.Assert(result.Replace(unknown), qt.IsFalse)
+	c.Assert(result.Contains(unknown), qt.IsFalse)
+}
+
+func TestMembersSelect(t *testing.T) {
+	c := qt.New(t)
+
+	result := NewMembers()
+	examples := getExamples(3)
+	examples[0].Metadata = map[string]string{"role": "storage"}
+	examples[2].Metadata = map[string]string{"role": "storage", "version": "1"}
+	for _, member := range examples {
+		result.Append(member)
+	}
+
+	storage := result.Select(func(p *Peer) bool { return p.Metadata["role"] == "storage" })
+	c.Assert(storage, qt.ContentEquals, []*Peer{examples[0], examples[2]})
+	c.Assert(result.Select(func(*Peer) bool { return false }), qt.HasLen, 0)
+
+	// The metadata survives the encoding of the members
+	encoded, err := result.ToJSON()
+	c.Assert(err, qt.IsNil)
+	decoded, err := NewMembers().FromJSON(encoded)
+	c.Assert(err, qt.IsNil)
+	c.Assert(decoded.Peers()[2].Metadata, qt.DeepEquals, examples[2].Metadata)
+}
+
+func TestMembersApply(t *testing.T) {
+	c := qt.New(t)
+
+	result := NewMembers()
+	examples := getExamples(2)
+	result.Append(examples[0])
+	state, incarnation, ok := result.Status(examples[0])
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(state, qt.Equals, Alive)
+	c.Assert(incarnation, qt.Equals, uint64(0))
+	_, _, ok = result.Status(examples[1])
+	c.Assert(ok, qt.IsFalse)
+
+	// Alive updates register unknown peers, but other updates are ignored
+	c.Assert(result.Apply(&Update{Peer: examples[1], State: Suspect}), qt.IsFalse)
+	c.Assert(result.Apply(&Update{Peer: examples[1], State: Alive, Incarnation: 2}), qt.IsTrue)
+	c.Assert(result.Contains(examples[1]), qt.IsTrue)
+
+	// Suspect updates override alive members with greater or equal
+	// incarnation, and suspected ones with greater incarnation
+	c.Assert(result.Apply(&Update{Peer: examples[1], State: Suspect, Incarnation: 1}), qt.IsFalse)
+	c.Assert(result.Apply(&Update{Peer: examples[1], State: Suspect, Incarnation: 2}), qt.IsTrue)
+	c.Assert(result.Apply(&Update{Peer: examples[1], State: Suspect, Incarnation: 2}), qt.IsFalse)
+	state, incarnation, _ = result.Status(examples[1])
+	c.Assert(state, qt.Equals, Suspect)
+	c.Assert(incarnation, qt.Equals, uint64(2))
+
+	// Alive updates refute suspicions only with greater incarnation
+	c.Assert(result.Apply(&Update{Peer: examples[1], State: Alive, Incarnation: 2}), qt.IsFalse)
+	c.Assert(result.Apply(&Update{Peer: examples[1], State: Alive, Incarnation: 3}), qt.IsTrue)
+	state, _, _ = result.Status(examples[1])
+	c.Assert(state, qt.Equals, Alive)
+
+	// Failed updates remove members with greater or equal incarnation
+	c.Assert(result.Apply(&Update{Peer: examples[1], State: Failed, Incarnation: 2}), qt.IsFalse)
+	c.Assert(result.Apply(&Update{Peer: examples[1], State: Failed, Incarnation: 3}), qt.IsTrue)
+	c.Assert(result.Contains(examples[1]), qt.IsFalse)
+	c.Assert(result.Apply(&Update{Peer: examples[1], State: Failed, Incarnation: 3}), qt.IsFalse)
+	c.Assert(result.Apply(nil), qt.IsFalse)
+}
+
 func TestMembersToJSON(t *testing.T) {
 	c := qt.New(t)
 
@@ -5,6 +5,10 @@
 package peer
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net"
 	"net/url"
@@ -13,6 +17,8 @@ import (
 const (
 	// baseHostname contains node address template
 	baseHostname string = "http://%s:%d"
+	// baseSecureHostname contains node address template over TLS
+	baseSecureHostname string = "https://%s:%d"
 	// baseString contains node address template
 	baseString string = "%s:%d"
 	// allAddresses contains the wildcard IP as string
@@ -24,11 +30,22 @@ var (
 	ErrPortAddress = fmt.Errorf("bad peer port provided")
 )
 
-// Peer struct contains peer address and port, information that identifies any
-// node and allows to others to communicate with it.
+// Peer struct contains peer address and port, information that allows to
+// others to communicate with it. If the peer has a PublicKey, it is
+// identified by the ID derived from it, unless it is identified by its
+// address and port. If the peer accepts encrypted messages, EncryptionKey
+// contains its X25519 public key. If the peer is not reachable directly (for
+// example, a browser connected through a WebSocket), Relay contains the peer
+// that forwards the messages to it. The Metadata contains arbitrary
+// information that the peer advertises to other peers when it connects, such
+// as its name, version, roles or supported protocols.
 type Peer struct {
-	Port    int    `json:"port"`
-	Address string `json:"address"`
+	Port          int               `json:"port"`
+	Address       string            `json:"address"`
+	PublicKey     ed25519.PublicKey `json:"key,omitempty"`
+	EncryptionKey []byte            `json:"encryption_key,omitempty"`
+	Relay         *Peer             `json:"relay,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
 }
 
 // New function creates a peer with the provided address and port as argument
@@ -79,11 +96,26 @@ func Me(port int, remote bool) (*Peer, error) {
 }
 
 // Equal function returns if the current peer is the same that the provided one.
-// It seems that both has the same address and port.
+// If both peers have public key, it seems that both has the same key, unless
+// it seems that both has the same address and port.
 func (p *Peer) Equal(to *Peer) bool {
+	if p.PublicKey != nil && to.PublicKey != nil {
+		return bytes.Equal(p.PublicKey, to.PublicKey)
+	}
 	return p.Address == to.Address && p.Port == to.Port
 }
 
+// ID function returns the identifier of the current peer derived from its
+// public key, as the hexadecimal version of the first 16 bytes of its SHA-256
+// hash. If the peer has not public key, it returns an empty string.
+func (p *Peer) ID() string {
+	if p.PublicKey == nil {
+		return ""
+	}
+	hash := sha256.Sum256(p.PublicKey)
+	return hex.EncodeToString(hash[:16])
+}
+
 // String function returns a human-readable format of the current peer.
 func (p *Peer) String() string {
 	return fmt.Sprintf(baseString, p.Address, p.Port)
@@ -93,3 +125,9 @@ func (p *Peer) String() string {
 func (p *Peer) Hostname() string {
 	return fmt.Sprintf(baseHostname, p.Address, p.Port)
 }
+
+// SecureHostname function returns the current peer information as URL form
+// using the secure (TLS) scheme.
+func (p *Peer) SecureHostname() string {
+	return fmt.Sprintf(baseSecureHostname, p.Address, p.Port)
+}
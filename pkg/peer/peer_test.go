@@ -1,6 +1,7 @@
 package peer
 
 import (
+	"crypto/ed25519"
 	"fmt"
 	"regexp"
 	"testing"
@@ -67,3 +68,43 @@ func TestPeerHostname(t *testing.T) {
 		t.Errorf("expected %s, got %s", expected, result)
 	}
 }
+
+func TestPeerSecureHostname(t *testing.T) {
+	me, _ := Me(5000, false)
+	expected := fmt.Sprintf(baseSecureHostname, me.Address, me.Port)
+	if result := me.SecureHostname(); expected != result {
+		t.Errorf("expected %s, got %s", expected, result)
+	}
+}
+
+func TestPeerID(t *testing.T) {
+	c := qt.New(t)
+
+	me, _ := Me(5000, false)
+	c.Assert(me.ID(), qt.Equals, "")
+
+	pubKey, _, err := ed25519.GenerateKey(nil)
+	c.Assert(err, qt.IsNil)
+	me.PublicKey = pubKey
+	c.Assert(me.ID(), qt.HasLen, 32)
+	c.Assert(me.ID(), qt.Equals, (&Peer{PublicKey: pubKey}).ID())
+}
+
+func TestPeerEqualKeys(t *testing.T) {
+	c := qt.New(t)
+
+	first, _, _ := ed25519.GenerateKey(nil)
+	second, _, _ := ed25519.GenerateKey(nil)
+	me, _ := Me(5000, false)
+	me.PublicKey = first
+
+	// Peers with keys are compared by key
+	candidate := &Peer{Address: me.Address, Port: me.Port, PublicKey: second}
+	c.Assert(me.Equal(candidate), qt.IsFalse)
+	candidate = &Peer{Address: allAddresses, Port: 5001, PublicKey: first}
+	c.Assert(me.Equal(candidate), qt.IsTrue)
+
+	// Peers without key are compared by address and port
+	candidate = &Peer{Address: me.Address, Port: me.Port}
+	c.Assert(me.Equal(candidate), qt.IsTrue)
+}
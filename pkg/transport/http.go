@@ -0,0 +1,382 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+)
+
+const (
+	// relayPath contains the path of the HTTP transport endpoint that
+	// forwards the incoming messages to the WebSocket clients connected to it.
+	relayPath string = "/relay"
+	// codecsHeader contains the HTTP header that the HTTP transport includes
+	// in its responses to advertise the content types of the codecs that it
+	// accepts.
+	codecsHeader string = "X-Peer-Codecs"
+)
+
+// HTTP struct implements the Transport interface using a HTTP client to send
+// messages to other peers and a HTTP server to listen to their requests. It is
+// the default transport of a node. It also accepts WebSocket connections to
+// allow to clients that can not listen for requests, such as browsers, to
+// join to the network as peers relayed by the current transport. If it is
+// created with TLS configuration, every communication is secured using HTTPS.
+// The messages are encoded as JSON unless other codec is negotiated with the
+// peer (see HTTP.SetCodecs), and the messages are relayed only if they pass
+// the checks of the relay guard (see HTTP.SetRelayGuard).
+type HTTP struct {
+	self       *peer.Peer
+	tls        *TLSConfig
+	client     *http.Client
+	server     *http.Server
+	sockets    map[string]*socket
+	guard      *RelayGuard
+	codecs     []message.Codec
+	peerCodecs map[string]message.Codec
+	mtx        *sync.Mutex
+}
+
+// NewHTTP function creates a new HTTP transport and returns it.
+func NewHTTP() *HTTP {
+	return &HTTP{
+		self:       nil,
+		tls:        nil,
+		client:     &http.Client{},
+		server:     nil, // Initialize as nil to know if the the server is started
+		sockets:    map[string]*socket{},
+		guard:      nil,
+		codecs:     []message.Codec{message.JSONCodec},
+		peerCodecs: map[string]message.Codec{},
+		mtx:        &sync.Mutex{},
+	}
+}
+
+// SetCodecs function sets the codecs that the transport accepts, sorted by
+// preference. Every request includes the codec used to encode the message as
+// its Content-Type header, and every response advertises the codecs accepted.
+// The first message sent to a peer, usually the connection request, is
+// encoded as JSON, and the next ones with the preferred codec that the peer
+// accepts, so peers with different codecs, or without codecs support, can
+// communicate. The JSONCodec is always accepted.
+func (t *HTTP) SetCodecs(codecs ...message.Codec) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.codecs = []message.Codec{}
+	for _, codec := range codecs {
+		if codec != nil && codec != message.JSONCodec {
+			t.codecs = append(t.codecs, codec)
+		}
+	}
+	t.codecs = append(t.codecs, message.JSONCodec)
+	t.peerCodecs = map[string]message.Codec{}
+}
+
+// SetRelayGuard function sets the checks that the transport applies to the
+// messages that its WebSocket clients send to other peers and to the messages
+// that other peers send to its WebSocket clients. Until it is set, every
+// message relayed is rejected.
+func (t *HTTP) SetRelayGuard(guard *RelayGuard) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.guard = guard
+}
+
+// Listen function creates a HTTP request multiplexer to assign the root path to
+// the handler provided, binds the address of the provided peer and starts the
+// HTTP server in background. The multiplexer also serves the WebSocket
+// endpoint and the relay endpoint to reach the WebSocket clients.
+func (t *HTTP) Listen(self *peer.Peer, handler Handler) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.server != nil {
+		return fmt.Errorf("transport already listening")
+	}
+
+	// Bind the address before start serving to be sure that the transport is
+	// ready to receive messages when the function returns.
+	listener, err := net.Listen("tcp", self.String())
+	if err != nil {
+		return err
+	}
+	if t.tls != nil {
+		listener = tls.NewListener(listener, t.tls.server())
+	}
+
+	// Listen on root every request and handle it with the provided handler.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", t.handleRequest(handler))
+	mux.HandleFunc(socketPath, t.handleSocket(handler))
+	mux.HandleFunc(relayPath, t.handleRelay())
+	t.self = self
+	t.server = &http.Server{Addr: self.String(), Handler: mux}
+	go t.server.Serve(listener)
+	return nil
+}
+
+// Dial function does nothing because HTTP requests does not require a
+// previous connection.
+func (t *HTTP) Dial(ctx context.Context, to *peer.Peer) error {
+	return nil
+}
+
+// Send function encodes the provided message as a HTTP request to the peer
+// provided, performs it and returns the response body. If the response status
+// is not 200, it returns the error associated to the status received. If the
+// peer is a WebSocket client connected to the current transport, the message
+// is pushed over its socket, and if it is connected to other transport, the
+// request is sent to the relay endpoint of that transport. The message is
+// encoded with the codec negotiated with the peer, that is updated with the
+// codecs advertised by its response. The request is cancelled if the provided
+// context is done.
+func (t *HTTP) Send(ctx context.Context, to *peer.Peer, msg *message.Message) ([]byte, error) {
+	t.mtx.Lock()
+	var s *socket
+	connected := false
+	if to.Relay != nil && t.self != nil && to.Relay.Equal(t.self) {
+		// Only the peers relayed by the current transport are reached
+		// through its sockets.
+		s, connected = t.sockets[socketKey(to.String())]
+	}
+	codec, negotiated := t.peerCodecs[to.String()]
+	t.mtx.Unlock()
+	if connected {
+		return nil, s.push(ctx, &socketFrame{Message: msg})
+	}
+	if !negotiated {
+		codec = message.JSONCodec
+	}
+
+	req, err := composeRequest(ctx, msg, to, t.tls != nil, codec)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if to.Relay == nil {
+		t.negotiate(to, res.Header.Get(codecsHeader))
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := statusErr(res.StatusCode); err != nil {
+		return nil, fmt.Errorf("%w: %d http status received from %s", err, res.StatusCode, to)
+	}
+	return body, nil
+}
+
+// Close function shutdowns the HTTP server if it is started.
+func (t *HTTP) Close() error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.server == nil {
+		return ErrClosed
+	}
+
+	// Close the WebSocket connections because they are hijacked and the
+	// server does not track them.
+	for _, s := range t.sockets {
+		s.conn.Close()
+	}
+	t.sockets = map[string]*socket{}
+
+	err := t.server.Shutdown(context.Background())
+	t.server = nil
+	return err
+}
+
+// negotiate function sets the codec to encode the messages sent to the provided
+// peer: the preferred one of the transport codecs that is included in the
+// provided list of content types advertised by the peer, or JSON if there is
+// none.
+func (t *HTTP) negotiate(to *peer.Peer, advertised string) {
+	accepted := map[string]bool{}
+	for _, contentType := range strings.Split(advertised, ",") {
+		accepted[strings.TrimSpace(contentType)] = true
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	for _, codec := range t.codecs {
+		if accepted[codec.ContentType()] {
+			t.peerCodecs[to.String()] = codec
+			return
+		}
+	}
+	delete(t.peerCodecs, to.String())
+}
+
+// accepts function returns the codec of the transport associated to the
+// provided content type, JSON if it is empty, or nil if the transport does
+// not accept it.
+func (t *HTTP) accepts(contentType string) message.Codec {
+	if contentType == "" {
+		// The peers without codecs support do not set the content type.
+		return message.JSONCodec
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	for _, codec := range t.codecs {
+		if codec.ContentType() == mediaType {
+			return codec
+		}
+	}
+	return nil
+}
+
+// advertised function returns the content types of the codecs accepted by the
+// transport, separated by commas.
+func (t *HTTP) advertised() string {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	contentTypes := make([]string, len(t.codecs))
+	for i, codec := range t.codecs {
+		contentTypes[i] = codec.ContentType()
+	}
+	return strings.Join(contentTypes, ", ")
+}
+
+// handleRequest function returns a http.HandlerFunc that decodes every request
+// received as a message, with the codec of its content type, and passes it to
+// the provided handler. If the handler returns an error, it responses with the
+// HTTP status associated to it, unless it responses with the handler result.
+// Every response advertises the codecs accepted by the transport.
+func (t *HTTP) handleRequest(handler Handler) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Set cors compatible headers when the request has OPTION method.
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "*")
+		if r.Method == http.MethodOptions {
+			http.Error(w, "No Content", http.StatusNoContent)
+			return
+		}
+
+		// Parse request to a message with the codec of its content type
+		w.Header().Set(codecsHeader, t.advertised())
+		codec := t.accepts(r.Header.Get("Content-Type"))
+		if codec == nil {
+			http.Error(w, "Message codec not supported", http.StatusUnsupportedMediaType)
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "no valid message provided", http.StatusBadRequest)
+			return
+		}
+
+		msg := new(message.Message).Decode(codec, data)
+		if msg == nil || msg.From == nil {
+			// If something fails decoding message from the request, response
+			// with a bad request HTTP error.
+			http.Error(w, "No valid Message provided", http.StatusBadRequest)
+			return
+		}
+
+		res, err := handler(msg)
+		if err != nil {
+			http.Error(w, err.Error(), errStatus(err))
+			return
+		}
+
+		if res != nil {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write(res)
+		}
+	}
+}
+
+// composeRequest function encodes the provided message with the provided codec
+// and creates a HTTP request to the peer provided, bound to the provided
+// context, with it as body and the content type of the codec. If the peer is
+// reachable through a relay, the message is encoded as JSON and the request is
+// sent to the relay endpoint of it. If secure is true, the request uses the
+// HTTPS scheme.
+func composeRequest(ctx context.Context, msg *message.Message, to *peer.Peer, secure bool, codec message.Codec) (*http.Request, error) {
+	if to.Relay != nil {
+		codec = message.JSONCodec
+	}
+	encMsg := msg.Encode(codec)
+	if encMsg == nil {
+		return nil, fmt.Errorf("error encoding message to %s", codec.ContentType())
+	}
+
+	host := to
+	if to.Relay != nil {
+		host = to.Relay
+	}
+	uri := host.Hostname()
+	if secure {
+		uri = host.SecureHostname()
+	}
+	if to.Relay != nil {
+		uri += relayPath + "?to=" + url.QueryEscape(to.String())
+	}
+	body := bytes.NewBuffer(encMsg)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, body)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding request to message: %w", err)
+	}
+	req.Host = msg.From.String()
+	req.Header.Set("Content-Type", codec.ContentType())
+
+	return req, nil
+}
+
+// errStatus function returns the HTTP status associated to the provided error.
+func errStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrBadMessage):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, ErrNotAllowed):
+		return http.StatusMethodNotAllowed
+	case errors.Is(err, ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// statusErr function returns the error associated to the provided HTTP status
+// or nil if the status is 200.
+func statusErr(status int) error {
+	switch status {
+	case http.StatusOK:
+		return nil
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType:
+		return ErrBadMessage
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusMethodNotAllowed:
+		return ErrNotAllowed
+	case http.StatusServiceUnavailable:
+		return ErrUnavailable
+	default:
+		return fmt.Errorf("unexpected response")
+	}
+}
@@ -0,0 +1,240 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+)
+
+func getRandomPort() int {
+	minSafePort, maxSafePort := 49152, 65535
+	limit := new(big.Int).SetInt64(int64(maxSafePort - minSafePort))
+	r, _ := rand.Int(rand.Reader, limit)
+	return int(r.Int64()) + minSafePort
+}
+
+func TestHTTPListenSend(t *testing.T) {
+	c := qt.New(t)
+
+	self, _ := peer.Me(getRandomPort(), false)
+	from, _ := peer.Me(getRandomPort(), false)
+
+	srv := NewHTTP()
+	err := srv.Listen(self, func(msg *message.Message) ([]byte, error) {
+		switch msg.Type {
+		case message.ConnectType:
+			return []byte("[]"), nil
+		case message.DisconnectType:
+			return nil, ErrForbidden
+		case message.DirectType:
+			return nil, ErrUnavailable
+		default:
+			if string(msg.Data) == "slow" {
+				time.Sleep(200 * time.Millisecond)
+				return nil, nil
+			}
+			c.Assert(msg.Data, qt.DeepEquals, []byte("test"))
+			return nil, nil
+		}
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(srv.Listen(self, nil), qt.IsNotNil)
+
+	client := NewHTTP()
+	c.Assert(client.Dial(context.Background(), self), qt.IsNil)
+
+	msg := new(message.Message).SetType(message.ConnectType).SetFrom(from)
+	res, err := client.Send(context.Background(), self, msg)
+	c.Assert(err, qt.IsNil)
+	c.Assert(res, qt.DeepEquals, []byte("[]"))
+
+	msg = new(message.Message).SetFrom(from).SetData([]byte("test"))
+	res, err = client.Send(context.Background(), self, msg)
+	c.Assert(err, qt.IsNil)
+	c.Assert(res, qt.HasLen, 0)
+
+	msg = new(message.Message).SetType(message.DisconnectType).SetFrom(from)
+	_, err = client.Send(context.Background(), self, msg)
+	c.Assert(err, qt.ErrorIs, ErrForbidden)
+
+	direct := new(message.Message).SetFrom(from).SetData([]byte("test")).SetTo(self)
+	_, err = client.Send(context.Background(), self, direct)
+	c.Assert(err, qt.ErrorIs, ErrUnavailable)
+
+	// The request is cancelled at the context deadline
+	slow := new(message.Message).SetFrom(from).SetData([]byte("slow"))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = client.Send(ctx, self, slow)
+	c.Assert(err, qt.ErrorIs, context.DeadlineExceeded)
+	c.Assert(time.Since(start) < 150*time.Millisecond, qt.IsTrue)
+
+	c.Assert(srv.Close(), qt.IsNil)
+	c.Assert(srv.Close(), qt.ErrorIs, ErrClosed)
+	_, err = client.Send(context.Background(), self, msg)
+	c.Assert(err, qt.IsNotNil)
+}
+
+func Test_handleRequest(t *testing.T) {
+	c := qt.New(t)
+
+	self, _ := peer.Me(getRandomPort(), false)
+	srv := NewHTTP()
+	err := srv.Listen(self, func(msg *message.Message) ([]byte, error) {
+		return nil, ErrNotAllowed
+	})
+	c.Assert(err, qt.IsNil)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodOptions, self.Hostname(), nil)
+	res, err := http.DefaultClient.Do(req)
+	c.Assert(err, qt.IsNil)
+	c.Assert(res.StatusCode, qt.Equals, http.StatusNoContent)
+	c.Assert(res.Header.Get("Access-Control-Allow-Origin"), qt.Equals, "*")
+
+	req, _ = http.NewRequest(http.MethodPost, self.Hostname(), bytes.NewBufferString("{"))
+	res, err = http.DefaultClient.Do(req)
+	c.Assert(err, qt.IsNil)
+	c.Assert(res.StatusCode, qt.Equals, http.StatusBadRequest)
+
+	msg := new(message.Message).SetFrom(self).SetData([]byte("test"))
+	req, _ = http.NewRequest(http.MethodPost, self.Hostname(), bytes.NewBuffer(msg.JSON()))
+	res, err = http.DefaultClient.Do(req)
+	c.Assert(err, qt.IsNil)
+	c.Assert(res.StatusCode, qt.Equals, http.StatusMethodNotAllowed)
+	c.Assert(res.Header.Get(codecsHeader), qt.Equals, "application/json")
+
+	req, _ = http.NewRequest(http.MethodPost, self.Hostname(), bytes.NewBuffer(msg.Encode(message.CBORCodec)))
+	req.Header.Set("Content-Type", "application/cbor")
+	res, err = http.DefaultClient.Do(req)
+	c.Assert(err, qt.IsNil)
+	c.Assert(res.StatusCode, qt.Equals, http.StatusUnsupportedMediaType)
+}
+
+func TestHTTPCodecs(t *testing.T) {
+	c := qt.New(t)
+
+	cbor, _ := peer.Me(getRandomPort(), false)
+	legacy, _ := peer.Me(getRandomPort(), false)
+	contentTypes := make(chan string, 1)
+	handler := func(msg *message.Message) ([]byte, error) {
+		return msg.Data, nil
+	}
+
+	srv := NewHTTP()
+	srv.SetCodecs(message.CBORCodec)
+	c.Assert(srv.Listen(cbor, handler), qt.IsNil)
+	defer srv.Close()
+
+	// The legacy server does not advertise codecs
+	legacySrv := &http.Server{Addr: legacy.String(), Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentTypes <- r.Header.Get("Content-Type")
+		data, _ := io.ReadAll(r.Body)
+		if msg := new(message.Message).SetJSON(data); msg != nil {
+			w.Write(msg.Data)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	})}
+	go legacySrv.ListenAndServe()
+	defer legacySrv.Close()
+
+	client := NewHTTP()
+	client.SetCodecs(message.CBORCodec)
+	c.Assert(client.advertised(), qt.Equals, "application/cbor, application/json")
+	msg := new(message.Message).SetFrom(cbor).SetData([]byte("test"))
+
+	// The first message is encoded as JSON, and the next ones with the
+	// codec advertised by the peer
+	for _, expected := range []string{"", "application/cbor"} {
+		client.mtx.Lock()
+		codec := client.peerCodecs[cbor.String()]
+		client.mtx.Unlock()
+		if expected == "" {
+			c.Assert(codec, qt.IsNil)
+		} else {
+			c.Assert(codec.ContentType(), qt.Equals, expected)
+		}
+		res, err := client.Send(context.Background(), cbor, msg)
+		c.Assert(err, qt.IsNil)
+		c.Assert(res, qt.DeepEquals, []byte("test"))
+	}
+
+	// The peers that do not advertise codecs keep receiving JSON
+	for i := 0; i < 2; i++ {
+		var res []byte
+		var err error
+		c.Assert(waitListening(func() error {
+			res, err = client.Send(context.Background(), legacy, msg)
+			return err
+		}), qt.IsNil)
+		c.Assert(res, qt.DeepEquals, []byte("test"))
+		c.Assert(<-contentTypes, qt.Equals, "application/json")
+	}
+
+	// The JSON clients are accepted by the servers with other codecs
+	res, err := NewHTTP().Send(context.Background(), cbor, msg)
+	c.Assert(err, qt.IsNil)
+	c.Assert(res, qt.DeepEquals, []byte("test"))
+}
+
+// waitListening function retries the provided function until the server that
+// it requests is listening.
+func waitListening(send func() error) error {
+	var err error
+	for i := 0; i < 50; i++ {
+		if err = send(); err == nil {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return err
+}
+
+func Test_composeRequest(t *testing.T) {
+	c := qt.New(t)
+
+	to, _ := peer.Me(getRandomPort(), false)
+	from, _ := peer.Me(getRandomPort(), false)
+	msg := new(message.Message).SetFrom(from).SetData([]byte("test"))
+
+	result, err := composeRequest(context.Background(), msg, to, false, message.JSONCodec)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.Method, qt.Equals, http.MethodPost)
+	c.Assert(result.Host, qt.Equals, from.String())
+	c.Assert(result.URL.String(), qt.Equals, to.Hostname())
+	body, err := io.ReadAll(result.Body)
+	c.Assert(err, qt.IsNil)
+	c.Assert(body, qt.DeepEquals, msg.JSON())
+	c.Assert(result.Header.Get("Content-Type"), qt.Equals, "application/json")
+
+	result, err = composeRequest(context.Background(), msg, to, false, message.CBORCodec)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.Header.Get("Content-Type"), qt.Equals, "application/cbor")
+	body, err = io.ReadAll(result.Body)
+	c.Assert(err, qt.IsNil)
+	c.Assert(body, qt.DeepEquals, msg.Encode(message.CBORCodec))
+
+	result, err = composeRequest(context.Background(), msg, to, true, message.JSONCodec)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.URL.String(), qt.Equals, to.SecureHostname())
+
+	relayed := &peer.Peer{Address: "browser", Port: 1, Relay: to}
+	result, err = composeRequest(context.Background(), msg, relayed, false, message.CBORCodec)
+	c.Assert(err, qt.IsNil)
+	c.Assert(result.URL.String(), qt.Equals, to.Hostname()+relayPath+"?to=browser%3A1")
+	c.Assert(result.Header.Get("Content-Type"), qt.Equals, "application/json")
+
+	_, err = composeRequest(context.Background(), new(message.Message), to, false, message.JSONCodec)
+	c.Assert(err, qt.IsNotNil)
+}
@@ -0,0 +1,274 @@
+package transport
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// noiseProtocol contains the name of the Noise protocol implemented, that uses
+// the XX handshake pattern, X25519 for key agreement, AES-GCM as cipher and
+// SHA-256 as hash function.
+const noiseProtocol string = "Noise_XX_25519_AESGCM_SHA256"
+
+// noiseKeySize contains the size of the X25519 public keys and the symmetric
+// keys used by the protocol.
+const noiseKeySize = 32
+
+// cipherState struct contains the AEAD cipher with the key agreed during the
+// handshake and the counter of the next nonce to use.
+type cipherState struct {
+	aead  cipher.AEAD
+	nonce uint64
+}
+
+// newCipherState function creates a cipherState with the provided key.
+func newCipherState(key []byte) (*cipherState, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &cipherState{aead: aead, nonce: 0}, nil
+}
+
+// encrypt function encrypts the provided plaintext with the provided nonce and
+// associated data.
+func (cs *cipherState) encrypt(nonce uint64, ad, plaintext []byte) []byte {
+	return cs.aead.Seal(nil, noiseNonce(nonce), plaintext, ad)
+}
+
+// decrypt function decrypts the provided ciphertext with the provided nonce
+// and associated data.
+func (cs *cipherState) decrypt(nonce uint64, ad, ciphertext []byte) ([]byte, error) {
+	return cs.aead.Open(nil, noiseNonce(nonce), ciphertext, ad)
+}
+
+// noiseNonce function encodes the provided counter as AES-GCM nonce following
+// the Noise specification: 4 bytes of zeros followed by the counter as 8
+// bytes big endian.
+func noiseNonce(n uint64) []byte {
+	return binary.BigEndian.AppendUint64(make([]byte, 4), n)
+}
+
+// handshakeState struct contains the state of a Noise XX handshake: the
+// symmetric state (chaining key, handshake hash and current cipher), the local
+// static and ephemeral keys and the remote ones.
+type handshakeState struct {
+	ck, h     []byte
+	cs        *cipherState
+	static    *ecdh.PrivateKey
+	ephemeral *ecdh.PrivateKey
+	rs, re    *ecdh.PublicKey
+	initiator bool
+}
+
+// newHandshake function initializes a Noise XX handshake with the provided
+// static key, as initiator or responder.
+func newHandshake(static *ecdh.PrivateKey, initiator bool) (*handshakeState, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// The protocol name fits into the hash length, so it is used padded with
+	// zeros as initial hash and chaining key. Then mix the empty prologue.
+	h := make([]byte, sha256.Size)
+	copy(h, noiseProtocol)
+	hs := &handshakeState{
+		ck:        append([]byte{}, h...),
+		h:         h,
+		static:    static,
+		ephemeral: ephemeral,
+		initiator: initiator,
+	}
+	hs.mixHash(nil)
+	return hs, nil
+}
+
+// writeInit function returns the first handshake message of the initiator:
+// -> e
+func (hs *handshakeState) writeInit() []byte {
+	e := hs.ephemeral.PublicKey().Bytes()
+	hs.mixHash(e)
+	hs.mixHash(nil) // empty payload
+	return e
+}
+
+// readInit function reads the first handshake message in the responder.
+func (hs *handshakeState) readInit(msg []byte) error {
+	if len(msg) != noiseKeySize {
+		return fmt.Errorf("no valid handshake message")
+	}
+
+	var err error
+	if hs.re, err = ecdh.X25519().NewPublicKey(msg); err != nil {
+		return err
+	}
+	hs.mixHash(msg)
+	hs.mixHash(nil) // empty payload
+	return nil
+}
+
+// writeResponse function returns the second handshake message of the
+// responder: <- e, ee, s, es
+func (hs *handshakeState) writeResponse() ([]byte, error) {
+	e := hs.ephemeral.PublicKey().Bytes()
+	hs.mixHash(e)
+	if err := hs.mixDH(hs.ephemeral, hs.re); err != nil {
+		return nil, err
+	}
+	s := hs.encryptAndHash(hs.static.PublicKey().Bytes())
+	if err := hs.mixDH(hs.static, hs.re); err != nil {
+		return nil, err
+	}
+	payload := hs.encryptAndHash(nil)
+	return append(append(e, s...), payload...), nil
+}
+
+// readResponse function reads the second handshake message in the initiator.
+func (hs *handshakeState) readResponse(msg []byte) error {
+	if len(msg) != 2*noiseKeySize+2*16 {
+		return fmt.Errorf("no valid handshake message")
+	}
+
+	var err error
+	if hs.re, err = ecdh.X25519().NewPublicKey(msg[:noiseKeySize]); err != nil {
+		return err
+	}
+	hs.mixHash(msg[:noiseKeySize])
+	if err := hs.mixDH(hs.ephemeral, hs.re); err != nil {
+		return err
+	}
+
+	s, err := hs.decryptAndHash(msg[noiseKeySize : 2*noiseKeySize+16])
+	if err != nil {
+		return err
+	}
+	if hs.rs, err = ecdh.X25519().NewPublicKey(s); err != nil {
+		return err
+	}
+	if err := hs.mixDH(hs.ephemeral, hs.rs); err != nil {
+		return err
+	}
+	_, err = hs.decryptAndHash(msg[2*noiseKeySize+16:])
+	return err
+}
+
+// writeFinish function returns the third handshake message of the initiator:
+// -> s, se
+func (hs *handshakeState) writeFinish() ([]byte, error) {
+	s := hs.encryptAndHash(hs.static.PublicKey().Bytes())
+	if err := hs.mixDH(hs.static, hs.re); err != nil {
+		return nil, err
+	}
+	return append(s, hs.encryptAndHash(nil)...), nil
+}
+
+// readFinish function reads the third handshake message in the responder.
+func (hs *handshakeState) readFinish(msg []byte) error {
+	if len(msg) != noiseKeySize+2*16 {
+		return fmt.Errorf("no valid handshake message")
+	}
+
+	s, err := hs.decryptAndHash(msg[:noiseKeySize+16])
+	if err != nil {
+		return err
+	}
+	if hs.rs, err = ecdh.X25519().NewPublicKey(s); err != nil {
+		return err
+	}
+	if err := hs.mixDH(hs.ephemeral, hs.rs); err != nil {
+		return err
+	}
+	_, err = hs.decryptAndHash(msg[noiseKeySize+16:])
+	return err
+}
+
+// split function returns the cipher states to send and receive messages once
+// the handshake is completed.
+func (hs *handshakeState) split() (*cipherState, *cipherState, error) {
+	k1, k2 := noiseHKDF(hs.ck, nil)
+	c1, err := newCipherState(k1)
+	if err != nil {
+		return nil, nil, err
+	}
+	c2, err := newCipherState(k2)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if hs.initiator {
+		return c1, c2, nil
+	}
+	return c2, c1, nil
+}
+
+// mixHash function updates the handshake hash with the provided data.
+func (hs *handshakeState) mixHash(data []byte) {
+	hash := sha256.New()
+	hash.Write(hs.h)
+	hash.Write(data)
+	hs.h = hash.Sum(nil)
+}
+
+// mixDH function updates the chaining key and the current cipher with the
+// result of the key agreement between the provided keys.
+func (hs *handshakeState) mixDH(private *ecdh.PrivateKey, public *ecdh.PublicKey) error {
+	secret, err := private.ECDH(public)
+	if err != nil {
+		return err
+	}
+
+	var key []byte
+	hs.ck, key = noiseHKDF(hs.ck, secret)
+	hs.cs, err = newCipherState(key)
+	return err
+}
+
+// encryptAndHash function encrypts the provided plaintext with the current
+// cipher, using the handshake hash as associated data, and mixes the result
+// into the handshake hash.
+func (hs *handshakeState) encryptAndHash(plaintext []byte) []byte {
+	ciphertext := hs.cs.encrypt(hs.cs.nonce, hs.h, plaintext)
+	hs.cs.nonce++
+	hs.mixHash(ciphertext)
+	return ciphertext
+}
+
+// decryptAndHash function decrypts the provided ciphertext with the current
+// cipher, using the handshake hash as associated data, and mixes it into the
+// handshake hash.
+func (hs *handshakeState) decryptAndHash(ciphertext []byte) ([]byte, error) {
+	plaintext, err := hs.cs.decrypt(hs.cs.nonce, hs.h, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	hs.cs.nonce++
+	hs.mixHash(ciphertext)
+	return plaintext, nil
+}
+
+// noiseHKDF function derives two keys from the provided chaining key and input
+// key material, as the Noise specification defines.
+func noiseHKDF(ck, ikm []byte) ([]byte, []byte) {
+	mac := hmac.New(sha256.New, ck)
+	mac.Write(ikm)
+	temp := mac.Sum(nil)
+
+	mac = hmac.New(sha256.New, temp)
+	mac.Write([]byte{0x01})
+	out1 := mac.Sum(nil)
+
+	mac = hmac.New(sha256.New, temp)
+	mac.Write(append(append([]byte{}, out1...), 0x02))
+	return out1, mac.Sum(nil)
+}
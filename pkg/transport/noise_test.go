@@ -0,0 +1,56 @@
+package transport
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func Test_noiseHandshake(t *testing.T) {
+	c := qt.New(t)
+
+	initiatorKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	responderKey, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	initiator, err := newHandshake(initiatorKey, true)
+	c.Assert(err, qt.IsNil)
+	responder, err := newHandshake(responderKey, false)
+	c.Assert(err, qt.IsNil)
+
+	c.Assert(responder.readInit(initiator.writeInit()), qt.IsNil)
+	res, err := responder.writeResponse()
+	c.Assert(err, qt.IsNil)
+	c.Assert(initiator.readResponse(res), qt.IsNil)
+	finish, err := initiator.writeFinish()
+	c.Assert(err, qt.IsNil)
+	c.Assert(responder.readFinish(finish), qt.IsNil)
+
+	// Both sides learn the static key of the other one
+	c.Assert(initiator.rs.Equal(responderKey.PublicKey()), qt.IsTrue)
+	c.Assert(responder.rs.Equal(initiatorKey.PublicKey()), qt.IsTrue)
+	c.Assert(initiator.h, qt.DeepEquals, responder.h)
+
+	// The cipher states of both sides are paired
+	iSend, iRecv, err := initiator.split()
+	c.Assert(err, qt.IsNil)
+	rSend, rRecv, err := responder.split()
+	c.Assert(err, qt.IsNil)
+	plaintext, err := rRecv.decrypt(0, nil, iSend.encrypt(0, nil, []byte("ping")))
+	c.Assert(err, qt.IsNil)
+	c.Assert(plaintext, qt.DeepEquals, []byte("ping"))
+	plaintext, err = iRecv.decrypt(0, nil, rSend.encrypt(0, nil, []byte("pong")))
+	c.Assert(err, qt.IsNil)
+	c.Assert(plaintext, qt.DeepEquals, []byte("pong"))
+	_, err = iRecv.decrypt(0, nil, iSend.encrypt(0, nil, []byte("ping")))
+	c.Assert(err, qt.IsNotNil)
+
+	// Tampered handshake messages are rejected
+	tampered, _ := newHandshake(initiatorKey, true)
+	other, _ := newHandshake(responderKey, false)
+	c.Assert(other.readInit(tampered.writeInit()), qt.IsNil)
+	res, _ = other.writeResponse()
+	res[len(res)-1] ^= 0xFF
+	c.Assert(tampered.readResponse(res), qt.IsNotNil)
+	c.Assert(tampered.readResponse(res[1:]), qt.IsNotNil)
+}
@@ -0,0 +1,394 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+)
+
+const (
+	// sessionInit identifies the message that starts a session handshake,
+	// which contains the initiator ephemeral key. The response contains the
+	// second handshake message of the responder.
+	sessionInit byte = iota
+	// sessionFinish identifies the message that completes a session
+	// handshake, which contains the initiator ephemeral key, to identify the
+	// handshake, followed by its encrypted static key.
+	sessionFinish byte = iota
+	// sessionData identifies a message encrypted with the session keys,
+	// which contains the sender static key, to identify the session, followed
+	// by the encrypted message.
+	sessionData byte = iota
+	// sessionReset identifies the response to a session message that does
+	// not belong to an established session or can not be decrypted, which
+	// requests to the sender to establish the session again.
+	sessionReset byte = iota
+)
+
+// errNoSession is returned when a session message does not belong to an
+// established session or can not be decrypted with its keys. The Secure
+// transport responds to it with a sessionReset message instead of the error,
+// to distinguish it from the rejections of the handler.
+var errNoSession = fmt.Errorf("%w: no secure session", ErrForbidden)
+
+// maxPendingHandshakes contains the maximum number of handshakes that a Secure
+// transport keeps pending to be completed. Once it is reached, other pending
+// handshake is discarded for every new one.
+const maxPendingHandshakes = 1024
+
+// session struct contains the cipher states of an established secure session
+// with a peer, the static key of that peer and a mutex to serialize its use.
+type session struct {
+	send, recv *cipherState
+	remote     []byte
+	mtx        *sync.Mutex
+}
+
+// Secure struct implements a Transport that secures the communication over
+// other one, establishing a session with every peer through a Noise XX
+// handshake. Once the session is established, every message and response
+// exchanged with the peer is encrypted and authenticated with the session
+// keys, that are ephemeral, providing forward secrecy. Sessions are
+// directional: the peer that sends the messages starts the handshake. The
+// inbound sessions are identified by the address and the static key of the
+// peer, so a handshake with other static key never replaces them.
+type Secure struct {
+	self     *peer.Peer
+	inner    Transport
+	key      *ecdh.PrivateKey
+	outbound map[string]*session
+	inbound  map[string]*session
+	pending  map[string]*handshakeState
+	mtx      *sync.Mutex
+}
+
+// NewSecure function creates a new Secure transport over the provided one
+// using the provided X25519 private key as static key of the sessions. Every
+// peer that communicates with it must use a Secure transport too.
+func NewSecure(inner Transport, key *ecdh.PrivateKey) *Secure {
+	return &Secure{
+		inner:    inner,
+		key:      key,
+		outbound: make(map[string]*session),
+		inbound:  make(map[string]*session),
+		pending:  make(map[string]*handshakeState),
+		mtx:      &sync.Mutex{},
+	}
+}
+
+// Listen function starts to listen for incoming messages through the inner
+// transport, handling the session handshakes and decrypting the session
+// messages before passing them to the provided handler. Messages that do not
+// belong to a session are rejected.
+func (t *Secure) Listen(self *peer.Peer, handler Handler) error {
+	t.mtx.Lock()
+	t.self = self
+	t.mtx.Unlock()
+	return t.inner.Listen(self, func(msg *message.Message) ([]byte, error) {
+		if msg.Type != message.SessionType {
+			return nil, fmt.Errorf("%w: secure session required", ErrForbidden)
+		} else if msg.From == nil || len(msg.Data) == 0 {
+			return nil, ErrBadMessage
+		}
+
+		from, data := msg.From.String(), msg.Data[1:]
+		switch msg.Data[0] {
+		case sessionInit:
+			return t.acceptInit(from, data)
+		case sessionFinish:
+			if len(data) < noiseKeySize {
+				return nil, ErrBadMessage
+			}
+			return nil, t.acceptFinish(from, data[:noiseKeySize], data[noiseKeySize:])
+		case sessionData:
+			if len(data) < noiseKeySize {
+				return nil, ErrBadMessage
+			}
+			res, err := t.handleData(from, data[:noiseKeySize], data[noiseKeySize:], handler)
+			if errors.Is(err, errNoSession) {
+				return []byte{sessionReset}, nil
+			}
+			return res, err
+		default:
+			return nil, ErrBadMessage
+		}
+	})
+}
+
+// Dial function prepares the inner transport to communicate with the provided
+// peer and establishes a secure session with it, if it does not exist yet.
+// The provided context bounds the handshake.
+func (t *Secure) Dial(ctx context.Context, to *peer.Peer) error {
+	if err := t.inner.Dial(ctx, to); err != nil {
+		return err
+	}
+
+	s := t.session(to)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.send != nil {
+		return nil
+	}
+	return t.handshake(ctx, to, s)
+}
+
+// Send function encrypts the provided message with the session established
+// with the provided peer and delivers it through the inner transport,
+// returning the decrypted response. If the session does not exist, it
+// establishes it first. If the peer does not recognize the session, for
+// example, because it was restarted, the session is established again and the
+// message is sent once more. The messages rejected by the peer handler are not
+// sent again. The provided context bounds the whole exchange,
+// including the handshakes.
+func (t *Secure) Send(ctx context.Context, to *peer.Peer, msg *message.Message) ([]byte, error) {
+	s := t.session(to)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.send == nil {
+		if err := t.handshake(ctx, to, s); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := t.roundTrip(ctx, to, s, msg)
+	if errors.Is(err, errNoSession) {
+		if err := t.handshake(ctx, to, s); err != nil {
+			return nil, err
+		}
+		res, err = t.roundTrip(ctx, to, s, msg)
+	}
+	return res, err
+}
+
+// Close function closes the inner transport and forgets every session.
+func (t *Secure) Close() error {
+	t.mtx.Lock()
+	t.outbound = make(map[string]*session)
+	t.inbound = make(map[string]*session)
+	t.pending = make(map[string]*handshakeState)
+	t.mtx.Unlock()
+	return t.inner.Close()
+}
+
+// session function returns the outbound session with the provided peer,
+// creating it if it does not exist yet. The session returned could be not
+// established.
+func (t *Secure) session(to *peer.Peer) *session {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	s, ok := t.outbound[to.String()]
+	if !ok {
+		s = &session{mtx: &sync.Mutex{}}
+		t.outbound[to.String()] = s
+	}
+	return s
+}
+
+// handshake function performs the initiator side of the Noise XX handshake
+// with the provided peer, updating the provided session with the resulting
+// keys. If the peer advertises an encryption key, it must match with the
+// static key received during the handshake. The session must be locked.
+func (t *Secure) handshake(ctx context.Context, to *peer.Peer, s *session) error {
+	s.send, s.recv, s.remote = nil, nil, nil
+	hs, err := newHandshake(t.key, true)
+	if err != nil {
+		return err
+	}
+
+	ephemeral := hs.writeInit()
+	res, err := t.inner.Send(ctx, to, t.sessionMessage(sessionInit, ephemeral))
+	if err != nil {
+		return err
+	} else if err := hs.readResponse(res); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadMessage, err)
+	}
+
+	remote := hs.rs.Bytes()
+	if to.EncryptionKey != nil && !bytes.Equal(to.EncryptionKey, remote) {
+		return fmt.Errorf("%w: unexpected peer session key", ErrForbidden)
+	}
+
+	finish, err := hs.writeFinish()
+	if err != nil {
+		return err
+	}
+	finish = append(append([]byte{}, ephemeral...), finish...)
+	if _, err := t.inner.Send(ctx, to, t.sessionMessage(sessionFinish, finish)); err != nil {
+		return err
+	}
+
+	if s.send, s.recv, err = hs.split(); err != nil {
+		return err
+	}
+	s.remote = remote
+	return nil
+}
+
+// roundTrip function encrypts and sends the provided message to the provided
+// peer using the session provided, and decrypts the response received. The
+// session must be locked.
+func (t *Secure) roundTrip(ctx context.Context, to *peer.Peer, s *session, msg *message.Message) ([]byte, error) {
+	data := append(t.key.PublicKey().Bytes(), s.seal(msg.JSON())...)
+	res, err := t.inner.Send(ctx, to, t.sessionMessage(sessionData, data))
+	if err != nil || len(res) == 0 {
+		return res, err
+	} else if len(res) == 1 && res[0] == sessionReset {
+		// The sealed responses are longer than a single byte
+		return nil, errNoSession
+	}
+	return s.open(res)
+}
+
+// acceptInit function reads the first message of a handshake started by the
+// provided peer and returns the second one, keeping the handshake pending,
+// identified by the peer address and its ephemeral key, until the peer
+// completes it.
+func (t *Secure) acceptInit(from string, data []byte) ([]byte, error) {
+	hs, err := newHandshake(t.key, false)
+	if err != nil {
+		return nil, err
+	} else if err := hs.readInit(data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadMessage, err)
+	}
+
+	res, err := hs.writeResponse()
+	if err != nil {
+		return nil, err
+	}
+
+	key := sessionKey(from, data)
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if _, exists := t.pending[key]; exists {
+		return nil, fmt.Errorf("%w: handshake already pending", ErrForbidden)
+	}
+	if len(t.pending) >= maxPendingHandshakes {
+		for other := range t.pending {
+			delete(t.pending, other)
+			break
+		}
+	}
+	t.pending[key] = hs
+	return res, nil
+}
+
+// acceptFinish function reads the last message of the pending handshake with
+// the provided peer and ephemeral key, and establishes the inbound session
+// with it, that replaces only the previous session of the peer with the same
+// static key.
+func (t *Secure) acceptFinish(from string, ephemeral, data []byte) error {
+	key := sessionKey(from, ephemeral)
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	hs, ok := t.pending[key]
+	if !ok {
+		return fmt.Errorf("%w: no pending handshake", ErrForbidden)
+	}
+	delete(t.pending, key)
+
+	if err := hs.readFinish(data); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadMessage, err)
+	}
+	send, recv, err := hs.split()
+	if err != nil {
+		return err
+	}
+	remote := hs.rs.Bytes()
+	t.inbound[sessionKey(from, remote)] = &session{send: send, recv: recv, remote: remote, mtx: &sync.Mutex{}}
+	return nil
+}
+
+// handleData function decrypts the provided data with the inbound session of
+// the provided peer and static key, passes the message to the provided handler
+// and returns its response encrypted. The sender of the decrypted message must
+// advertise the static key authenticated during the handshake. If the session
+// does not exist or the data can not be decrypted, it returns an errNoSession
+// error, so the sender establishes the session again.
+func (t *Secure) handleData(from string, static, data []byte, handler Handler) ([]byte, error) {
+	t.mtx.Lock()
+	s, ok := t.inbound[sessionKey(from, static)]
+	t.mtx.Unlock()
+	if !ok {
+		return nil, errNoSession
+	}
+
+	s.mtx.Lock()
+	plain, err := s.open(data)
+	s.mtx.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNoSession, err)
+	}
+
+	msg := new(message.Message)
+	if err := json.Unmarshal(plain, msg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadMessage, err)
+	} else if msg.From == nil || msg.From.String() != from ||
+		!bytes.Equal(msg.From.EncryptionKey, s.remote) {
+		return nil, fmt.Errorf("%w: sender does not match the session", ErrForbidden)
+	}
+
+	res, err := handler(msg)
+	if err != nil || len(res) == 0 {
+		return res, err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.seal(res), nil
+}
+
+// seal function encrypts the provided plaintext with the next nonce of the
+// session, returning the nonce followed by the ciphertext.
+func (s *session) seal(plaintext []byte) []byte {
+	nonce := s.send.nonce
+	s.send.nonce++
+	sealed := binary.BigEndian.AppendUint64(nil, nonce)
+	return append(sealed, s.send.encrypt(nonce, nil, plaintext)...)
+}
+
+// open function decrypts the provided data sealed by the other side of the
+// session. The nonce must be greater than the last one received to prevent
+// replayed messages.
+func (s *session) open(data []byte) ([]byte, error) {
+	if len(data) < 8 {
+		return nil, ErrBadMessage
+	}
+	nonce := binary.BigEndian.Uint64(data[:8])
+	if nonce < s.recv.nonce {
+		return nil, fmt.Errorf("%w: replayed session message", ErrBadMessage)
+	}
+
+	plaintext, err := s.recv.decrypt(nonce, nil, data[8:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadMessage, err)
+	}
+	s.recv.nonce = nonce + 1
+	return plaintext, nil
+}
+
+// sessionKey function returns the key that identifies the sessions and the
+// handshakes of the peer with the provided address and key.
+func sessionKey(from string, key []byte) string {
+	return from + "/" + hex.EncodeToString(key)
+}
+
+// sessionMessage function composes a session message from the current peer
+// with the provided kind and content.
+func (t *Secure) sessionMessage(kind byte, data []byte) *message.Message {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return &message.Message{
+		Type: message.SessionType,
+		Data: append([]byte{kind}, data...),
+		From: t.self,
+	}
+}
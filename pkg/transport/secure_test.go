@@ -0,0 +1,151 @@
+package transport
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+)
+
+func TestSecure(t *testing.T) {
+	c := qt.New(t)
+
+	newPeer := func() (*peer.Peer, *ecdh.PrivateKey) {
+		p, _ := peer.Me(getRandomPort(), false)
+		key, _ := ecdh.X25519().GenerateKey(rand.Reader)
+		p.EncryptionKey = key.PublicKey().Bytes()
+		return p, key
+	}
+	self, selfKey := newPeer()
+	from, fromKey := newPeer()
+
+	received := make(chan *message.Message, 1)
+	srv := NewSecure(NewHTTP(), selfKey)
+	err := srv.Listen(self, func(msg *message.Message) ([]byte, error) {
+		received <- msg
+		if string(msg.Data) == "reject" {
+			return nil, ErrForbidden
+		}
+		return msg.Data, nil
+	})
+	c.Assert(err, qt.IsNil)
+	defer srv.Close()
+
+	client := NewSecure(NewHTTP(), fromKey)
+	c.Assert(client.Listen(from, func(*message.Message) ([]byte, error) { return nil, nil }), qt.IsNil)
+	defer client.Close()
+	c.Assert(client.Dial(context.Background(), self), qt.IsNil)
+
+	// Messages and responses are exchanged through the session
+	msg := new(message.Message).SetFrom(from).SetData([]byte("test"))
+	for i := 0; i < 3; i++ {
+		res, err := client.Send(context.Background(), self, msg)
+		c.Assert(err, qt.IsNil)
+		c.Assert(res, qt.DeepEquals, []byte("test"))
+		c.Assert((<-received).Data, qt.DeepEquals, []byte("test"))
+	}
+
+	// Plain messages are rejected
+	_, err = NewHTTP().Send(context.Background(), self, msg)
+	c.Assert(err, qt.ErrorIs, ErrForbidden)
+
+	// Session messages can not be replayed
+	s := client.session(self)
+	s.send.nonce--
+	_, err = client.roundTrip(context.Background(), self, s, msg)
+	c.Assert(err, qt.ErrorIs, errNoSession)
+
+	// The messages rejected by the handler are not sent again through a new
+	// session
+	send := s.send
+	_, err = client.Send(context.Background(), self, new(message.Message).SetFrom(from).SetData([]byte("reject")))
+	c.Assert(err, qt.ErrorIs, ErrForbidden)
+	c.Assert(err, qt.Not(qt.ErrorIs), errNoSession)
+	c.Assert(s.send, qt.Equals, send)
+	c.Assert((<-received).Data, qt.DeepEquals, []byte("reject"))
+	select {
+	case <-received:
+		t.Fatal("rejected message delivered twice")
+	default:
+	}
+
+	// The session is established again if the peer can not decrypt the
+	// messages
+	s.send, _ = newCipherState(make([]byte, 32))
+	res, err := client.Send(context.Background(), self, msg)
+	c.Assert(err, qt.IsNil)
+	c.Assert(res, qt.DeepEquals, []byte("test"))
+	<-received
+
+	// Handshakes with other static key do not replace the peer session
+	_, attackerKey := newPeer()
+	attacker := NewSecure(NewHTTP(), attackerKey)
+	attacker.self = from
+	c.Assert(attacker.Dial(context.Background(), self), qt.IsNil)
+	nonce := s.send.nonce
+	res, err = client.Send(context.Background(), self, msg)
+	c.Assert(err, qt.IsNil)
+	c.Assert(res, qt.DeepEquals, []byte("test"))
+	c.Assert(s.send.nonce, qt.Equals, nonce+1)
+	<-received
+
+	// The session is established again if the peer forgets it
+	srv.mtx.Lock()
+	srv.inbound = make(map[string]*session)
+	srv.mtx.Unlock()
+	res, err = client.Send(context.Background(), self, msg)
+	c.Assert(err, qt.IsNil)
+	c.Assert(res, qt.DeepEquals, []byte("test"))
+	<-received
+
+	// Senders must advertise the key authenticated by the session
+	impostor, _ := newPeer()
+	msg = new(message.Message).SetFrom(impostor).SetData([]byte("test"))
+	_, err = client.Send(context.Background(), self, msg)
+	c.Assert(err, qt.ErrorIs, ErrForbidden)
+
+	// Peers must own the key that they advertise
+	unexpected, _ := newPeer()
+	unexpected.Address, unexpected.Port = self.Address, self.Port
+	other := NewSecure(NewHTTP(), fromKey)
+	c.Assert(other.Listen(impostor, func(*message.Message) ([]byte, error) { return nil, nil }), qt.IsNil)
+	defer other.Close()
+	_, err = other.Send(context.Background(), unexpected, msg)
+	c.Assert(err, qt.ErrorIs, ErrForbidden)
+}
+
+func TestSecureDial(t *testing.T) {
+	c := qt.New(t)
+
+	// The peer accepts the connections but never responds
+	self, _ := peer.Me(getRandomPort(), false)
+	listener, err := net.Listen("tcp", self.String())
+	c.Assert(err, qt.IsNil)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	key, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	client := NewSecure(NewHTTP(), key)
+	from, _ := peer.Me(getRandomPort(), false)
+	c.Assert(client.Listen(from, func(*message.Message) ([]byte, error) { return nil, nil }), qt.IsNil)
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	c.Assert(client.Dial(ctx, self), qt.ErrorIs, context.DeadlineExceeded)
+	c.Assert(time.Since(start) < time.Second, qt.IsTrue)
+}
@@ -0,0 +1,369 @@
+package transport
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+)
+
+const (
+	// maxFrameSize contains the maximum size in bytes of a frame payload
+	// accepted by the TCP transport.
+	maxFrameSize uint32 = 64 << 20
+	// dialTimeout contains the maximum time to wait for a TCP connection to
+	// be established.
+	dialTimeout = 5 * time.Second
+)
+
+// Status codes written as first byte of every TCP response frame to report the
+// result of handling the request message.
+const (
+	statusOK          byte = iota
+	statusBadMessage  byte = iota
+	statusForbidden   byte = iota
+	statusNotAllowed  byte = iota
+	statusInternal    byte = iota
+	statusUnavailable byte = iota
+)
+
+// tcpConn struct wraps a persistent TCP connection with a semaphore to allow
+// only one request at a time through it, that can be abandoned while waiting
+// for it.
+type tcpConn struct {
+	conn net.Conn
+	sem  chan struct{}
+}
+
+// TCP struct implements the Transport interface over raw TCP connections. It
+// keeps one long-lived connection per peer, that is reopened automatically if
+// it fails, and frames every message with its length as prefix. Every request
+// frame contains a JSON encoded message and every response frame contains a
+// status byte followed by the response content.
+type TCP struct {
+	listener net.Listener
+	conns    map[string]*tcpConn
+	accepted map[net.Conn]bool
+	mtx      *sync.Mutex
+}
+
+// NewTCP function creates a new TCP transport and returns it.
+func NewTCP() *TCP {
+	return &TCP{
+		listener: nil,
+		conns:    map[string]*tcpConn{},
+		accepted: map[net.Conn]bool{},
+		mtx:      &sync.Mutex{},
+	}
+}
+
+// Listen function binds the address of the provided peer and starts a
+// goroutine accepting incoming connections. Every accepted connection is
+// served by its own goroutine, that reads request frames from it, passes them
+// to the provided handler and writes back the result.
+func (t *TCP) Listen(self *peer.Peer, handler Handler) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.listener != nil {
+		return fmt.Errorf("transport already listening")
+	}
+
+	listener, err := net.Listen("tcp", self.String())
+	if err != nil {
+		return err
+	}
+	t.listener = listener
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			t.mtx.Lock()
+			t.accepted[conn] = true
+			t.mtx.Unlock()
+			go t.serve(conn, handler)
+		}
+	}()
+	return nil
+}
+
+// Dial function opens a persistent connection with the provided peer if it
+// does not exist yet, until the provided context is done.
+func (t *TCP) Dial(ctx context.Context, to *peer.Peer) error {
+	_, err := t.conn(ctx, to)
+	return err
+}
+
+// Send function writes the provided message as a frame through the connection
+// with the peer provided and reads its response. If the connection fails, it
+// is reopened and the message is sent again once. The connection deadline is
+// set to the provided context one, and its pending reads and writes are
+// aborted if the context is done, closing the connection.
+func (t *TCP) Send(ctx context.Context, to *peer.Peer, msg *message.Message) ([]byte, error) {
+	encMsg := msg.JSON()
+	if encMsg == nil {
+		return nil, fmt.Errorf("error encoding message to JSON")
+	}
+
+	res, err := t.roundTrip(ctx, to, encMsg)
+	if err != nil && ctx.Err() == nil {
+		// The connection could be closed by the other peer, so reconnect and
+		// try it again.
+		res, err = t.roundTrip(ctx, to, encMsg)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%w: sending to %s", ctx.Err(), to)
+		}
+		return nil, err
+	}
+
+	if len(res) == 0 {
+		return nil, fmt.Errorf("empty response received from %s", to)
+	}
+	if err := frameStatusErr(res[0], res[1:]); err != nil {
+		return nil, fmt.Errorf("%w: received from %s", err, to)
+	}
+	return res[1:], nil
+}
+
+// Close function stops accepting new connections and closes every connection
+// opened by or accepted by the current transport.
+func (t *TCP) Close() error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.listener == nil {
+		return ErrClosed
+	}
+
+	err := t.listener.Close()
+	for conn := range t.accepted {
+		conn.Close()
+	}
+	for _, c := range t.conns {
+		c.conn.Close()
+	}
+
+	t.listener = nil
+	t.accepted = map[net.Conn]bool{}
+	t.conns = map[string]*tcpConn{}
+	return err
+}
+
+// conn function returns the persistent connection with the provided peer,
+// opening it if it does not exist yet, until the provided context is done.
+func (t *TCP) conn(ctx context.Context, to *peer.Peer) (*tcpConn, error) {
+	t.mtx.Lock()
+	c, exists := t.conns[to.String()]
+	t.mtx.Unlock()
+	if exists {
+		return c, nil
+	}
+
+	// Dial without holding the mutex to not block the communication with
+	// other peers.
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", to.String())
+	if err != nil {
+		return nil, err
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if c, exists := t.conns[to.String()]; exists {
+		// Other goroutine opened the connection meanwhile, so use it.
+		conn.Close()
+		return c, nil
+	}
+	c = &tcpConn{conn: conn, sem: make(chan struct{}, 1)}
+	t.conns[to.String()] = c
+	return c, nil
+}
+
+// hangup function closes the provided connection with the provided peer and
+// forgets it, if it was not replaced yet.
+func (t *TCP) hangup(to *peer.Peer, c *tcpConn) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	c.conn.Close()
+	if t.conns[to.String()] == c {
+		delete(t.conns, to.String())
+	}
+}
+
+// roundTrip function writes the provided payload as a frame through the
+// connection with the provided peer and reads the response frame, until the
+// provided context is done. If the connection fails, it is closed.
+func (t *TCP) roundTrip(ctx context.Context, to *peer.Peer, payload []byte) ([]byte, error) {
+	c, err := t.conn(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case c.sem <- struct{}{}:
+		defer func() { <-c.sem }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	stop, err := bindConn(ctx, c.conn.SetDeadline)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+
+	if err := writeFrame(c.conn, payload); err != nil {
+		t.hangup(to, c)
+		return nil, err
+	}
+	res, err := readFrame(c.conn)
+	if err != nil {
+		t.hangup(to, c)
+		return nil, err
+	}
+	return res, nil
+}
+
+// bindConn function binds the deadline of a connection, set with the provided
+// function, to the provided context: it sets the context deadline and sets a
+// past one if the context is done, aborting the pending operations. The
+// function returned unbinds them and must be called once the operations end.
+func bindConn(ctx context.Context, setDeadline func(time.Time) error) (func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	deadline, _ := ctx.Deadline()
+	if err := setDeadline(deadline); err != nil {
+		return nil, err
+	}
+	if ctx.Done() == nil {
+		return func() {}, nil
+	}
+
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			setDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		setDeadline(time.Time{})
+	}, nil
+}
+
+// serve function reads request frames from the provided connection until it
+// is closed, decodes them as messages, passes them to the handler provided and
+// writes back its result as response frame.
+func (t *TCP) serve(conn net.Conn, handler Handler) {
+	defer func() {
+		t.mtx.Lock()
+		delete(t.accepted, conn)
+		t.mtx.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		payload, err := readFrame(conn)
+		if err != nil {
+			return
+		}
+
+		var res []byte
+		msg := new(message.Message).SetJSON(payload)
+		if msg == nil || msg.From == nil {
+			res = append([]byte{statusBadMessage}, []byte(ErrBadMessage.Error())...)
+		} else if data, err := handler(msg); err != nil {
+			res = append([]byte{errFrameStatus(err)}, []byte(err.Error())...)
+		} else {
+			res = append([]byte{statusOK}, data...)
+		}
+
+		if err := writeFrame(conn, res); err != nil {
+			return
+		}
+	}
+}
+
+// writeFrame function writes the provided payload into the writer provided
+// prefixed by its length as 4 bytes big endian unsigned integer.
+func writeFrame(w io.Writer, payload []byte) error {
+	if len(payload) > int(maxFrameSize) {
+		return fmt.Errorf("frame too large: %d bytes", len(payload))
+	}
+
+	frame := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	copy(frame[4:], payload)
+	_, err := w.Write(frame)
+	return err
+}
+
+// readFrame function reads a length-prefixed frame from the provided reader
+// and returns its payload.
+func readFrame(r io.Reader) ([]byte, error) {
+	prefix := make([]byte, 4)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(prefix)
+	if size > maxFrameSize {
+		return nil, fmt.Errorf("frame too large: %d bytes", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// errFrameStatus function returns the frame status associated to the provided
+// error.
+func errFrameStatus(err error) byte {
+	switch {
+	case errors.Is(err, ErrBadMessage):
+		return statusBadMessage
+	case errors.Is(err, ErrForbidden):
+		return statusForbidden
+	case errors.Is(err, ErrNotAllowed):
+		return statusNotAllowed
+	case errors.Is(err, ErrUnavailable):
+		return statusUnavailable
+	default:
+		return statusInternal
+	}
+}
+
+// frameStatusErr function returns the error associated to the provided frame
+// status, including the reason received, or nil if the status is statusOK.
+func frameStatusErr(status byte, reason []byte) error {
+	switch status {
+	case statusOK:
+		return nil
+	case statusBadMessage:
+		return fmt.Errorf("%w: %s", ErrBadMessage, reason)
+	case statusForbidden:
+		return fmt.Errorf("%w: %s", ErrForbidden, reason)
+	case statusNotAllowed:
+		return fmt.Errorf("%w: %s", ErrNotAllowed, reason)
+	case statusUnavailable:
+		return fmt.Errorf("%w: %s", ErrUnavailable, reason)
+	default:
+		return fmt.Errorf("unexpected response: %s", reason)
+	}
+}
@@ -0,0 +1,112 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+)
+
+func TestTCPListenSend(t *testing.T) {
+	c := qt.New(t)
+
+	self, _ := peer.Me(getRandomPort(), false)
+	from, _ := peer.Me(getRandomPort(), false)
+	handler := func(msg *message.Message) ([]byte, error) {
+		switch msg.Type {
+		case message.ConnectType:
+			return []byte("[]"), nil
+		case message.DisconnectType:
+			return nil, ErrForbidden
+		case message.DirectType:
+			return nil, ErrUnavailable
+		default:
+			if string(msg.Data) == "slow" {
+				time.Sleep(200 * time.Millisecond)
+			}
+			return msg.Data, nil
+		}
+	}
+
+	srv := NewTCP()
+	c.Assert(srv.Listen(self, handler), qt.IsNil)
+	c.Assert(srv.Listen(self, handler), qt.IsNotNil)
+
+	client := NewTCP()
+	c.Assert(client.Dial(context.Background(), self), qt.IsNil)
+
+	msg := new(message.Message).SetType(message.ConnectType).SetFrom(from)
+	res, err := client.Send(context.Background(), self, msg)
+	c.Assert(err, qt.IsNil)
+	c.Assert(res, qt.DeepEquals, []byte("[]"))
+
+	msg = new(message.Message).SetFrom(from).SetData([]byte("test"))
+	res, err = client.Send(context.Background(), self, msg)
+	c.Assert(err, qt.IsNil)
+	c.Assert(res, qt.DeepEquals, []byte("test"))
+
+	msg = new(message.Message).SetType(message.DisconnectType).SetFrom(from)
+	_, err = client.Send(context.Background(), self, msg)
+	c.Assert(err, qt.ErrorIs, ErrForbidden)
+
+	direct := new(message.Message).SetFrom(from).SetData([]byte("test")).SetTo(self)
+	_, err = client.Send(context.Background(), self, direct)
+	c.Assert(err, qt.ErrorIs, ErrUnavailable)
+
+	t.Run("stop at the context deadline", func(t *testing.T) {
+		slow := new(message.Message).SetFrom(from).SetData([]byte("slow"))
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := client.Send(ctx, self, slow)
+		c.Assert(err, qt.ErrorIs, context.DeadlineExceeded)
+		c.Assert(time.Since(start) < 150*time.Millisecond, qt.IsTrue)
+
+		// The connection is reopened for the next messages
+		msg := new(message.Message).SetFrom(from).SetData([]byte("test"))
+		res, err := client.Send(context.Background(), self, msg)
+		c.Assert(err, qt.IsNil)
+		c.Assert(res, qt.DeepEquals, []byte("test"))
+	})
+
+	t.Run("reconnect after the connection is closed", func(t *testing.T) {
+		c.Assert(srv.Close(), qt.IsNil)
+		c.Assert(srv.Close(), qt.ErrorIs, ErrClosed)
+
+		msg := new(message.Message).SetFrom(from).SetData([]byte("test"))
+		_, err := client.Send(context.Background(), self, msg)
+		c.Assert(err, qt.IsNotNil)
+
+		c.Assert(srv.Listen(self, handler), qt.IsNil)
+		defer srv.Close()
+		res, err := client.Send(context.Background(), self, msg)
+		c.Assert(err, qt.IsNil)
+		c.Assert(res, qt.DeepEquals, []byte("test"))
+	})
+}
+
+func Test_frames(t *testing.T) {
+	c := qt.New(t)
+
+	buf := new(bytes.Buffer)
+	c.Assert(writeFrame(buf, []byte("first")), qt.IsNil)
+	c.Assert(writeFrame(buf, []byte{}), qt.IsNil)
+	c.Assert(buf.Len(), qt.Equals, 4+5+4)
+
+	payload, err := readFrame(buf)
+	c.Assert(err, qt.IsNil)
+	c.Assert(payload, qt.DeepEquals, []byte("first"))
+	payload, err = readFrame(buf)
+	c.Assert(err, qt.IsNil)
+	c.Assert(payload, qt.HasLen, 0)
+	_, err = readFrame(buf)
+	c.Assert(err, qt.IsNotNil)
+
+	buf = bytes.NewBuffer([]byte{0xff, 0xff, 0xff, 0xff})
+	_, err = readFrame(buf)
+	c.Assert(err, qt.ErrorMatches, "frame too large.*")
+}
@@ -0,0 +1,57 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+)
+
+// TLSConfig struct contains the certificates used by the HTTP transport to
+// secure the communication with other peers. The Certificate is presented by
+// the server to the peers that send requests to it, and the ClientCertificate
+// is presented to the peers requested. If ClientCAs is provided, the server
+// requires and verifies the client certificates against it (mutual TLS). The
+// RootCAs are used to verify the server certificates of other peers, if it is
+// not provided, the system pool is used.
+type TLSConfig struct {
+	Certificate       tls.Certificate
+	ClientCertificate *tls.Certificate
+	ClientCAs         *x509.CertPool
+	RootCAs           *x509.CertPool
+}
+
+// NewHTTPS function creates a new HTTP transport that secures every
+// communication with other peers using TLS with the provided configuration.
+func NewHTTPS(config *TLSConfig) *HTTP {
+	t := NewHTTP()
+	t.tls = config
+	t.client.Transport = &http.Transport{TLSClientConfig: config.client()}
+	return t
+}
+
+// server function returns the tls.Config to use by the server of the HTTP
+// transport, requiring client certificates if client CAs are provided.
+func (config *TLSConfig) server() *tls.Config {
+	serverConfig := &tls.Config{
+		Certificates: []tls.Certificate{config.Certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if config.ClientCAs != nil {
+		serverConfig.ClientCAs = config.ClientCAs
+		serverConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return serverConfig
+}
+
+// client function returns the tls.Config to use by the client of the HTTP
+// transport, presenting the client certificate if it is provided.
+func (config *TLSConfig) client() *tls.Config {
+	clientConfig := &tls.Config{
+		RootCAs:    config.RootCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+	if config.ClientCertificate != nil {
+		clientConfig.Certificates = []tls.Certificate{*config.ClientCertificate}
+	}
+	return clientConfig
+}
@@ -0,0 +1,116 @@
+package transport
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+)
+
+// testCA function creates a self-signed certificate authority and returns a
+// function to issue certificates signed by it for localhost, and the pool
+// that contains it.
+func testCA(t *testing.T) (func() tls.Certificate, *x509.CertPool) {
+	c := qt.New(t)
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, qt.IsNil)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gop2p test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	c.Assert(err, qt.IsNil)
+	ca, err := x509.ParseCertificate(caDER)
+	c.Assert(err, qt.IsNil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	serial := int64(1)
+	issue := func() tls.Certificate {
+		serial++
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		c.Assert(err, qt.IsNil)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "localhost"},
+			DNSNames:     []string{"localhost"},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		c.Assert(err, qt.IsNil)
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+	return issue, pool
+}
+
+func TestHTTPSMutualTLS(t *testing.T) {
+	c := qt.New(t)
+
+	issue, pool := testCA(t)
+	self, _ := peer.Me(getRandomPort(), false)
+	from, _ := peer.Me(getRandomPort(), false)
+
+	srv := NewHTTPS(&TLSConfig{Certificate: issue(), ClientCAs: pool, RootCAs: pool})
+	err := srv.Listen(self, func(msg *message.Message) ([]byte, error) {
+		return msg.Data, nil
+	})
+	c.Assert(err, qt.IsNil)
+	defer srv.Close()
+	msg := new(message.Message).SetFrom(from).SetData([]byte("test"))
+
+	t.Run("client with valid certificate", func(t *testing.T) {
+		cert := issue()
+		client := NewHTTPS(&TLSConfig{Certificate: cert, ClientCertificate: &cert, RootCAs: pool})
+		res, err := client.Send(context.Background(), self, msg)
+		c.Assert(err, qt.IsNil)
+		c.Assert(res, qt.DeepEquals, []byte("test"))
+	})
+
+	t.Run("client without certificate", func(t *testing.T) {
+		client := NewHTTPS(&TLSConfig{Certificate: issue(), RootCAs: pool})
+		_, err := client.Send(context.Background(), self, msg)
+		c.Assert(err, qt.IsNotNil)
+	})
+
+	t.Run("client with untrusted certificate", func(t *testing.T) {
+		untrusted, _ := testCA(t)
+		cert := untrusted()
+		client := NewHTTPS(&TLSConfig{Certificate: cert, ClientCertificate: &cert, RootCAs: pool})
+		_, err := client.Send(context.Background(), self, msg)
+		c.Assert(err, qt.IsNotNil)
+	})
+
+	t.Run("client that does not trust the server", func(t *testing.T) {
+		_, untrustedPool := testCA(t)
+		cert := issue()
+		client := NewHTTPS(&TLSConfig{Certificate: cert, ClientCertificate: &cert, RootCAs: untrustedPool})
+		_, err := client.Send(context.Background(), self, msg)
+		c.Assert(err, qt.IsNotNil)
+	})
+
+	t.Run("plain HTTP client", func(t *testing.T) {
+		_, err := NewHTTP().Send(context.Background(), self, msg)
+		c.Assert(err, qt.IsNotNil)
+	})
+}
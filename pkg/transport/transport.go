@@ -0,0 +1,91 @@
+// transport package abstracts the carrier that gop2p nodes use to exchange
+// messages. It defines the Transport interface, that allows to a node to
+// listen for incoming messages, dial other peers, send messages to them and
+// close every resource associated, and provides the default implementation
+// over HTTP.
+package transport
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+)
+
+var (
+	// ErrBadMessage is returned when the received message can not be decoded
+	// or it is not valid.
+	ErrBadMessage = fmt.Errorf("no valid message provided")
+	// ErrForbidden is returned when the sender of the message is not allowed
+	// to perform the requested action, for example, when it is not a
+	// registered member of the network.
+	ErrForbidden = fmt.Errorf("peer not registered")
+	// ErrNotAllowed is returned when the type of the received message is not
+	// supported.
+	ErrNotAllowed = fmt.Errorf("message type not allowed")
+	// ErrClosed is returned when the transport is used after being closed.
+	ErrClosed = fmt.Errorf("transport closed")
+	// ErrUnavailable is returned when the receiver can not handle the message
+	// at the moment, for example, because it is overloaded. The message can be
+	// sent again later.
+	ErrUnavailable = fmt.Errorf("peer unavailable")
+)
+
+// Handler function type defines the function that a Transport calls for every
+// incoming message. It returns the content of the response that will be
+// delivered to the sender or an error if the message is rejected. The
+// Transport must report the error to the sender preserving the error
+// defined by this package (ErrBadMessage, ErrForbidden, etc.).
+type Handler func(msg *message.Message) ([]byte, error)
+
+// Transport interface abstracts the carrier used by a node to communicate with
+// other network peers. Any implementation must be safe for concurrent use.
+type Transport interface {
+	// Listen function starts to accept incoming messages intended to the
+	// provided peer, passing each one to the handler provided. It must return
+	// once the transport is ready to receive messages, or with an error if it
+	// can not.
+	Listen(self *peer.Peer, handler Handler) error
+	// Dial function prepares the transport to communicate with the provided
+	// peer, for example, opening a connection with it. Connectionless
+	// transports can do nothing. If the provided context is done before the
+	// transport is ready, it must stop and return an error wrapping the
+	// context error.
+	Dial(ctx context.Context, to *peer.Peer) error
+	// Send function delivers the provided message to the peer provided and
+	// returns the content of its response. If the provided context is done
+	// before the response is received, it must stop and return an error
+	// wrapping the context error.
+	Send(ctx context.Context, to *peer.Peer, msg *message.Message) ([]byte, error)
+	// Close function stops listening for incoming messages and releases every
+	// resource associated to the transport.
+	Close() error
+}
+
+// Negotiator interface is implemented by the transports that can encode the
+// messages with other codecs than JSON, negotiating the codec with every peer.
+type Negotiator interface {
+	// SetCodecs function sets the codecs that the transport accepts, sorted
+	// by preference.
+	SetCodecs(codecs ...message.Codec)
+}
+
+// RelayGuard struct contains the checks that a Relayer applies to the messages
+// before relaying them. Member function returns the registered network member
+// equal to the provided peer, or nil if it is not a member, and Verify
+// function returns an error defined by this package if the sender of the
+// provided message is not allowed to send it.
+type RelayGuard struct {
+	Member func(p *peer.Peer) *peer.Peer
+	Verify func(msg *message.Message) error
+}
+
+// Relayer interface is implemented by the transports that relay messages
+// between other peers, such as the HTTP one with its WebSocket clients.
+type Relayer interface {
+	// SetRelayGuard function sets the checks that the transport applies to
+	// the messages before relaying them. Without them, the transport does
+	// not relay any message.
+	SetRelayGuard(guard *RelayGuard)
+}
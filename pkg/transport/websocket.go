@@ -0,0 +1,438 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+)
+
+const (
+	// socketPath contains the path of the HTTP transport endpoint that
+	// upgrades the incoming requests to WebSocket connections.
+	socketPath string = "/ws"
+	// socketGUID contains the globally unique identifier defined by RFC 6455
+	// to compute the handshake accept key.
+	socketGUID string = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+// WebSocket frame opcodes defined by RFC 6455.
+const (
+	opContinuation byte = 0x0
+	opText         byte = 0x1
+	opBinary       byte = 0x2
+	opClose        byte = 0x8
+	opPing         byte = 0x9
+	opPong         byte = 0xA
+)
+
+// socketFrame struct contains the content of every frame sent by the transport
+// to a WebSocket client. It contains a message pushed to the client or the
+// response (or error) to a message received from it.
+type socketFrame struct {
+	Message  *message.Message `json:"message,omitempty"`
+	Response []byte           `json:"response,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// socket struct wraps a WebSocket connection with the peer registered through
+// it and a mutex to write frames safely from different goroutines.
+type socket struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	peer   *peer.Peer
+	mtx    *sync.Mutex
+}
+
+// push function encodes the provided frame as JSON and writes it to the
+// client as a text frame. The write is aborted if the provided context is done
+// before it finishes.
+func (s *socket) push(ctx context.Context, frame *socketFrame) error {
+	payload, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	stop, err := bindConn(ctx, s.conn.SetWriteDeadline)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	if err := writeSocketFrame(s.conn, opText, payload, false); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w: pushing to %s", ctx.Err(), s.peer)
+		}
+		return err
+	}
+	return nil
+}
+
+// handleSocket function returns a http.HandlerFunc that upgrades the request
+// to a WebSocket connection and serves it. The first message received through
+// the socket must be a connection message, that registers the client as a
+// peer reachable through the current transport. Then, every message sent to
+// that peer is pushed over the socket. The messages received from the client
+// are passed to the handler provided, unless they are intended to other
+// network members, then they are forwarded to them. When the socket is
+// closed, a disconnection message from the client is passed to the handler.
+func (t *HTTP) handleSocket(handler Handler) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s, err := upgradeSocket(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer func() {
+			s.conn.Close()
+			if s.peer == nil {
+				return
+			}
+
+			t.mtx.Lock()
+			if t.sockets[socketKey(s.peer.String())] == s {
+				delete(t.sockets, socketKey(s.peer.String()))
+			}
+			t.mtx.Unlock()
+			msg := new(message.Message).SetType(message.DisconnectType).SetFrom(s.peer)
+			handler(msg)
+		}()
+
+		for {
+			payload, err := s.read()
+			if err != nil {
+				return
+			}
+
+			res, err := t.handleSocketMessage(r.Context(), s, payload, handler)
+			frame := &socketFrame{Response: res}
+			if err != nil {
+				frame.Error = err.Error()
+			}
+			if err := s.push(r.Context(), frame); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleSocketMessage function decodes the payload received through the
+// provided socket as a message and handles it. The first message must be a
+// connection message, and the socket is registered only if the handler
+// accepts it. Then, the messages that are not intended to the current
+// transport are forwarded to their recipients, if every one is a network
+// member and the relay guard accepts the sender.
+func (t *HTTP) handleSocketMessage(ctx context.Context, s *socket, payload []byte, handler Handler) ([]byte, error) {
+	msg := new(message.Message).SetJSON(payload)
+	if msg == nil || msg.From == nil {
+		return nil, ErrBadMessage
+	}
+
+	t.mtx.Lock()
+	self, guard := t.self, t.guard
+	t.mtx.Unlock()
+	if s.peer == nil {
+		// The first message must be a connection one, from the socket peer
+		// relayed by the current transport.
+		if msg.Type != message.ConnectType {
+			return nil, ErrForbidden
+		}
+		return t.registerSocket(s, msg, self, handler)
+	} else if !msg.From.Equal(s.peer) {
+		return nil, fmt.Errorf("%w: sender does not match the socket peer", ErrBadMessage)
+	}
+	msg.From = s.peer
+
+	// Handle locally the messages without recipients or intended to the current
+	// transport peer and forward the rest to the registered members, never to
+	// the addresses provided by the client.
+	local := len(msg.To) == 0
+	recipients := []*peer.Peer{}
+	for _, to := range msg.To {
+		if to.Equal(self) {
+			local = true
+			continue
+		} else if guard == nil {
+			return nil, fmt.Errorf("%w: messages relaying not allowed", ErrForbidden)
+		}
+		member := guard.Member(to)
+		if member == nil {
+			return nil, fmt.Errorf("%w: recipient %s is not a member", ErrForbidden, to)
+		}
+		recipients = append(recipients, member)
+	}
+	if len(recipients) > 0 {
+		if err := guard.Verify(msg); err != nil {
+			return nil, err
+		}
+	}
+	for _, to := range recipients {
+		if _, err := t.Send(ctx, to, msg); err != nil {
+			return nil, err
+		}
+	}
+	if local {
+		return handler(msg)
+	}
+	return nil, nil
+}
+
+// registerSocket function passes the provided connection message to the
+// handler as sent by a peer relayed by the provided transport peer, and
+// registers the provided socket for that peer if the handler accepts it. It
+// rejects the connection if other socket is already registered for the same
+// peer.
+func (t *HTTP) registerSocket(s *socket, msg *message.Message, self *peer.Peer, handler Handler) ([]byte, error) {
+	relayed := &peer.Peer{
+		Address:       msg.From.Address,
+		Port:          msg.From.Port,
+		PublicKey:     msg.From.PublicKey,
+		EncryptionKey: msg.From.EncryptionKey,
+		Relay:         self,
+		Metadata:      msg.From.Metadata,
+	}
+	t.mtx.Lock()
+	_, exists := t.sockets[socketKey(relayed.String())]
+	t.mtx.Unlock()
+	if exists {
+		return nil, fmt.Errorf("%w: peer already connected through other socket", ErrForbidden)
+	}
+
+	msg.From = relayed
+	res, err := handler(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if _, exists := t.sockets[socketKey(relayed.String())]; exists {
+		return nil, fmt.Errorf("%w: peer already connected through other socket", ErrForbidden)
+	}
+	t.sockets[socketKey(relayed.String())] = s
+	s.peer = relayed
+	return res, nil
+}
+
+// socketKey function returns the key of the socket registered for the relayed
+// peer with the provided address, scoped to the relay, so it never matches a
+// peer reachable directly with the same address.
+func socketKey(address string) string {
+	return "relayed/" + address
+}
+
+// handleRelay function returns a http.HandlerFunc that pushes the message
+// received to the WebSocket client defined by the 'to' parameter of the
+// request, if the relay guard accepts its sender.
+func (t *HTTP) handleRelay() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t.mtx.Lock()
+		s, exists := t.sockets[socketKey(r.URL.Query().Get("to"))]
+		t.mtx.Unlock()
+		if !exists {
+			http.Error(w, "Peer not found", http.StatusNotFound)
+			return
+		}
+
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "no valid message provided", http.StatusBadRequest)
+			return
+		}
+		msg := new(message.Message).SetJSON(data)
+		if msg == nil || msg.From == nil {
+			http.Error(w, "No valid Message provided", http.StatusBadRequest)
+			return
+		}
+
+		t.mtx.Lock()
+		guard := t.guard
+		t.mtx.Unlock()
+		if guard == nil {
+			http.Error(w, "messages relaying not allowed", http.StatusForbidden)
+			return
+		} else if err := guard.Verify(msg); err != nil {
+			http.Error(w, err.Error(), errStatus(err))
+			return
+		}
+
+		if err := s.push(r.Context(), &socketFrame{Message: msg}); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		}
+	}
+}
+
+// upgradeSocket function checks that the provided request is a valid WebSocket
+// handshake, responses to it and hijacks its connection.
+func upgradeSocket(w http.ResponseWriter, r *http.Request) (*socket, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || key == "" ||
+		!strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		!strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade") {
+		return nil, fmt.Errorf("no valid websocket handshake provided")
+	} else if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, fmt.Errorf("websocket version not supported")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("websocket not supported")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	handshake := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + socketAccept(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(handshake)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &socket{conn: conn, reader: rw.Reader, mtx: &sync.Mutex{}}, nil
+}
+
+// socketAccept function computes the handshake accept key associated to the
+// provided client key.
+func socketAccept(key string) string {
+	hash := sha1.Sum([]byte(key + socketGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// read function reads frames from the current socket until a complete data
+// message is received and returns its payload. It responds to the ping frames
+// and returns io.EOF when a close frame is received.
+func (s *socket) read() ([]byte, error) {
+	var payload []byte
+	for {
+		fin, opcode, data, err := readSocketFrame(s.reader)
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case opClose:
+			s.mtx.Lock()
+			writeSocketFrame(s.conn, opClose, nil, false)
+			s.mtx.Unlock()
+			return nil, io.EOF
+		case opPing:
+			s.mtx.Lock()
+			err = writeSocketFrame(s.conn, opPong, data, false)
+			s.mtx.Unlock()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opText, opBinary, opContinuation:
+			if len(payload)+len(data) > int(maxFrameSize) {
+				return nil, fmt.Errorf("websocket message too large")
+			}
+			payload = append(payload, data...)
+		}
+
+		if fin {
+			return payload, nil
+		}
+	}
+}
+
+// writeSocketFrame function writes a single (final) WebSocket frame with the
+// opcode and payload provided into the writer. If mask is true, the payload is
+// masked with a random key, as the clients must do.
+func writeSocketFrame(w io.Writer, opcode byte, payload []byte, mask bool) error {
+	header := []byte{0x80 | opcode, 0}
+	size := len(payload)
+	switch {
+	case size < 126:
+		header[1] = byte(size)
+	case size <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(size))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(size))
+	}
+
+	if mask {
+		key := make([]byte, 4)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		header[1] |= 0x80
+		header = append(header, key...)
+
+		masked := make([]byte, size)
+		for i := range payload {
+			masked[i] = payload[i] ^ key[i%4]
+		}
+		payload = masked
+	}
+
+	_, err := w.Write(append(header, payload...))
+	return err
+}
+
+// readSocketFrame function reads a single WebSocket frame from the provided
+// reader, unmasking its payload if it is required. It returns if the frame is
+// the final one of the message, its opcode and its payload.
+func readSocketFrame(r io.Reader) (bool, byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return false, 0, nil, err
+	}
+	fin, opcode := header[0]&0x80 != 0, header[0]&0x0F
+	masked, size := header[1]&0x80 != 0, uint64(header[1]&0x7F)
+
+	switch size {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return false, 0, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return false, 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(ext)
+	}
+	if size > uint64(maxFrameSize) {
+		return false, 0, nil, fmt.Errorf("frame too large: %d bytes", size)
+	}
+
+	key := make([]byte, 4)
+	if masked {
+		if _, err := io.ReadFull(r, key); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
@@ -0,0 +1,206 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/lucasmenendez/gop2p/pkg/message"
+	"github.com/lucasmenendez/gop2p/pkg/peer"
+)
+
+func dialSocket(t *testing.T, to *peer.Peer) (net.Conn, *bufio.Reader) {
+	c := qt.New(t)
+
+	conn, err := net.Dial("tcp", to.String())
+	c.Assert(err, qt.IsNil)
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\n"+
+		"Connection: Upgrade\r\nSec-WebSocket-Key: %s\r\n"+
+		"Sec-WebSocket-Version: 13\r\n\r\n", socketPath, to.String(), key)
+
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, nil)
+	c.Assert(err, qt.IsNil)
+	c.Assert(res.StatusCode, qt.Equals, http.StatusSwitchingProtocols)
+	c.Assert(res.Header.Get("Sec-WebSocket-Accept"), qt.Equals, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=")
+	return conn, reader
+}
+
+func readSocket(t *testing.T, reader *bufio.Reader) *socketFrame {
+	c := qt.New(t)
+
+	_, opcode, payload, err := readSocketFrame(reader)
+	c.Assert(err, qt.IsNil)
+	c.Assert(opcode, qt.Equals, opText)
+	frame := new(socketFrame)
+	c.Assert(json.Unmarshal(payload, frame), qt.IsNil)
+	return frame
+}
+
+func TestHTTPWebSocket(t *testing.T) {
+	c := qt.New(t)
+
+	self, _ := peer.Me(getRandomPort(), false)
+	client, _ := peer.New("browser", 1)
+	intruder, _ := peer.New("intruder", 2)
+	other, _ := peer.Me(getRandomPort(), false)
+	relayed := &peer.Peer{Address: client.Address, Port: client.Port, Relay: self}
+	disconnected := make(chan *peer.Peer, 1)
+
+	srv := NewHTTP()
+	err := srv.Listen(self, func(msg *message.Message) ([]byte, error) {
+		switch msg.Type {
+		case message.ConnectType:
+			if msg.From.Port == intruder.Port {
+				return nil, ErrForbidden
+			}
+			return []byte("[]"), nil
+		case message.DisconnectType:
+			disconnected <- msg.From
+			return nil, nil
+		default:
+			return msg.Data, nil
+		}
+	})
+	c.Assert(err, qt.IsNil)
+	defer srv.Close()
+	// Only the other peer and the socket peer are members
+	srv.SetRelayGuard(&RelayGuard{
+		Member: func(p *peer.Peer) *peer.Peer {
+			if p.Equal(other) {
+				return other
+			}
+			return nil
+		},
+		Verify: func(msg *message.Message) error {
+			if !msg.From.Equal(other) && !msg.From.Equal(client) {
+				return ErrForbidden
+			}
+			return nil
+		},
+	})
+	forwarded := make(chan *message.Message, 1)
+	otherSrv := NewHTTP()
+	c.Assert(otherSrv.Listen(other, func(msg *message.Message) ([]byte, error) {
+		forwarded <- msg
+		return nil, nil
+	}), qt.IsNil)
+	defer otherSrv.Close()
+	conn, reader := dialSocket(t, self)
+
+	// The first message must be a connection message
+	msg := new(message.Message).SetFrom(client).SetData([]byte("test"))
+	c.Assert(writeSocketFrame(conn, opText, msg.JSON(), true), qt.IsNil)
+	c.Assert(readSocket(t, reader).Error, qt.Equals, ErrForbidden.Error())
+
+	msg = new(message.Message).SetType(message.ConnectType).SetFrom(client)
+	c.Assert(writeSocketFrame(conn, opText, msg.JSON(), true), qt.IsNil)
+	c.Assert(readSocket(t, reader).Response, qt.DeepEquals, []byte("[]"))
+
+	msg = new(message.Message).SetFrom(client).SetData([]byte("test"))
+	c.Assert(writeSocketFrame(conn, opText, msg.JSON(), true), qt.IsNil)
+	c.Assert(readSocket(t, reader).Response, qt.DeepEquals, []byte("test"))
+
+	// The messages are forwarded only to the members, never to the
+	// addresses provided by the client
+	msg = new(message.Message).SetFrom(client).SetData([]byte("forwarded")).SetTo(other)
+	c.Assert(writeSocketFrame(conn, opText, msg.JSON(), true), qt.IsNil)
+	c.Assert(readSocket(t, reader).Error, qt.Equals, "")
+	c.Assert((<-forwarded).Data, qt.DeepEquals, []byte("forwarded"))
+	stranger, _ := peer.Me(getRandomPort(), false)
+	msg = new(message.Message).SetFrom(client).SetData([]byte("forwarded")).SetTo(stranger)
+	c.Assert(writeSocketFrame(conn, opText, msg.JSON(), true), qt.IsNil)
+	c.Assert(readSocket(t, reader).Error, qt.Matches, ErrForbidden.Error()+".*")
+
+	// Other sockets can not connect as the same peer
+	second, secondReader := dialSocket(t, self)
+	defer second.Close()
+	msg = new(message.Message).SetType(message.ConnectType).SetFrom(client)
+	c.Assert(writeSocketFrame(second, opText, msg.JSON(), true), qt.IsNil)
+	c.Assert(readSocket(t, secondReader).Error, qt.Not(qt.Equals), "")
+
+	// Sockets whose connection is rejected are not registered
+	msg = new(message.Message).SetType(message.ConnectType).SetFrom(intruder)
+	c.Assert(writeSocketFrame(second, opText, msg.JSON(), true), qt.IsNil)
+	c.Assert(readSocket(t, secondReader).Error, qt.Equals, ErrForbidden.Error())
+	intruderRelayed := &peer.Peer{Address: intruder.Address, Port: intruder.Port, Relay: self}
+	_, err = NewHTTP().Send(context.Background(), intruderRelayed, new(message.Message).SetFrom(other).SetData([]byte("test")))
+	c.Assert(err, qt.IsNotNil)
+
+	// Messages to the socket peer relayed by the transport are pushed over
+	// the socket
+	msg = new(message.Message).SetFrom(self).SetData([]byte("pushed"))
+	_, err = srv.Send(context.Background(), relayed, msg)
+	c.Assert(err, qt.IsNil)
+	frame := readSocket(t, reader)
+	c.Assert(frame.Message.Data, qt.DeepEquals, []byte("pushed"))
+
+	// Other transports reach the socket peer through the relay
+	msg = new(message.Message).SetFrom(other).SetData([]byte("relayed"))
+	_, err = NewHTTP().Send(context.Background(), relayed, msg)
+	c.Assert(err, qt.IsNil)
+	frame = readSocket(t, reader)
+	c.Assert(frame.Message.Data, qt.DeepEquals, []byte("relayed"))
+	c.Assert(frame.Message.From.Equal(other), qt.IsTrue)
+
+	// The messages whose sender is not accepted are not relayed
+	msg = new(message.Message).SetFrom(stranger).SetData([]byte("forged"))
+	_, err = NewHTTP().Send(context.Background(), relayed, msg)
+	c.Assert(err, qt.ErrorIs, ErrForbidden)
+
+	// Closing the socket disconnects the peer
+	c.Assert(writeSocketFrame(conn, opClose, nil, true), qt.IsNil)
+	c.Assert((<-disconnected).Equal(client), qt.IsTrue)
+	_, err = NewHTTP().Send(context.Background(), relayed, msg)
+	c.Assert(err, qt.IsNotNil)
+}
+
+func Test_socketFrames(t *testing.T) {
+	c := qt.New(t)
+
+	for _, size := range []int{0, 125, 126, 0xFFFF, 0x10000} {
+		payload := bytes.Repeat([]byte("a"), size)
+		for _, mask := range []bool{false, true} {
+			buf := new(bytes.Buffer)
+			c.Assert(writeSocketFrame(buf, opBinary, payload, mask), qt.IsNil)
+			fin, opcode, result, err := readSocketFrame(buf)
+			c.Assert(err, qt.IsNil)
+			c.Assert(fin, qt.IsTrue)
+			c.Assert(opcode, qt.Equals, opBinary)
+			c.Assert(result, qt.DeepEquals, payload)
+		}
+	}
+
+	// Fragmented messages are joined and ping frames responded
+	buf := new(bytes.Buffer)
+	buf.Write([]byte{opText, 3, 'f', 'o', 'o'})
+	buf.Write([]byte{0x80 | opPing, 0})
+	buf.Write([]byte{0x80 | opContinuation, 3, 'b', 'a', 'r'})
+	out := new(bytes.Buffer)
+	s := &socket{conn: &fakeConn{out}, reader: bufio.NewReader(buf), mtx: &sync.Mutex{}}
+	payload, err := s.read()
+	c.Assert(err, qt.IsNil)
+	c.Assert(payload, qt.DeepEquals, []byte("foobar"))
+	c.Assert(out.Bytes(), qt.DeepEquals, []byte{0x80 | opPong, 0})
+}
+
+// fakeConn struct implements net.Conn writing into a buffer.
+type fakeConn struct {
+	*bytes.Buffer
+}
+
+func (fakeConn) Close() error                       { return nil }
+func (fakeConn) LocalAddr() net.Addr                { return nil }
+func (fakeConn) RemoteAddr() net.Addr               { return nil }
+func (fakeConn) SetDeadline(_ time.Time) error      { return nil }
+func (fakeConn) SetReadDeadline(_ time.Time) error  { return nil }
+func (fakeConn) SetWriteDeadline(_ time.Time) error { return nil }